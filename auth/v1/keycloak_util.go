@@ -15,6 +15,7 @@ type ContextKey struct {
 var (
 	AuthUser   = ContextKey{Key: "authUser"}
 	AuthHeader = ContextKey{Key: "authHeader"}
+	AuthToken  = ContextKey{Key: "authToken"}
 )
 
 type UserInfo struct {
@@ -57,6 +58,14 @@ func GetUserID(ctx context.Context) (string, bool) {
 	return info.ID, ok
 }
 
+func GetCustomerID(ctx context.Context) (string, bool) {
+	info, ok := getUserInfo(ctx)
+	if !ok {
+		return "", ok
+	}
+	return info.CustomerID, ok
+}
+
 func GetUserUUID(ctx context.Context) (uuid.UUID, error) {
 	info, ok := getUserInfo(ctx)
 	if !ok {
@@ -16,6 +16,9 @@ func UserInfoMiddleware(next http.Handler) http.Handler {
 			ctx = context.WithValue(ctx, AuthHeader, userinfoHeader)
 			r = r.WithContext(ctx)
 		}
+		if authorization := r.Header.Get("Authorization"); authorization != "" {
+			r = r.WithContext(context.WithValue(r.Context(), AuthToken, authorization))
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/gofrs/uuid"
+	auth "github.com/tjarkmeyer/golang-toolkit/auth/v1"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const versionCheckKey = "toolkit:version_check"
+
+// ErrVersionConflict - returned when a record was modified concurrently since it was loaded
+var ErrVersionConflict = errors.New("record was modified concurrently")
+
+// Model - base model with UUID primary key, audit columns and soft delete
+type Model struct {
+	ID        uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"`
+	CreatedBy string         `json:"createdBy,omitempty"`
+	UpdatedBy string         `json:"updatedBy,omitempty"`
+}
+
+// IntModel - base model with auto increment primary key, audit columns and soft delete
+type IntModel struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"`
+	CreatedBy string         `json:"createdBy,omitempty"`
+	UpdatedBy string         `json:"updatedBy,omitempty"`
+}
+
+// Versioned - adds the version column checked by the OptimisticLockPlugin
+type Versioned struct {
+	Version int64 `gorm:"not null" json:"version"`
+}
+
+// AuditPlugin - fills CreatedBy and UpdatedBy with the ID of the authenticated user of the context
+type AuditPlugin struct{}
+
+// NewAuditPlugin - creates the audit plugin
+func NewAuditPlugin() *AuditPlugin {
+	return &AuditPlugin{}
+}
+
+func (p *AuditPlugin) Name() string {
+	return "toolkit:audit"
+}
+
+func (p *AuditPlugin) Initialize(db *gorm.DB) error {
+	err := db.Callback().Create().Before("gorm:create").Register(p.Name()+":before_create", p.beforeCreate)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register(p.Name()+":before_update", p.beforeUpdate)
+}
+
+func (p *AuditPlugin) beforeCreate(db *gorm.DB) {
+	userID, ok := auditUser(db)
+	if !ok {
+		return
+	}
+
+	for _, name := range []string{"CreatedBy", "UpdatedBy"} {
+		field := db.Statement.Schema.LookUpField(name)
+		if field == nil {
+			continue
+		}
+		eachRecord(db, func(rv reflect.Value) {
+			if _, zero := field.ValueOf(db.Statement.Context, rv); zero {
+				db.AddError(field.Set(db.Statement.Context, rv, userID))
+			}
+		})
+	}
+}
+
+func (p *AuditPlugin) beforeUpdate(db *gorm.DB) {
+	userID, ok := auditUser(db)
+	if !ok {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField("UpdatedBy")
+	if field == nil {
+		return
+	}
+	db.Statement.SetColumn(field.DBName, userID, true)
+	selectColumn(db, field.DBName)
+}
+
+// OptimisticLockPlugin - guards updates of models with a Version column.
+// Updates only apply if the stored version still matches and increment it,
+// otherwise they fail with ErrVersionConflict.
+type OptimisticLockPlugin struct{}
+
+// NewOptimisticLockPlugin - creates the optimistic locking plugin
+func NewOptimisticLockPlugin() *OptimisticLockPlugin {
+	return &OptimisticLockPlugin{}
+}
+
+func (p *OptimisticLockPlugin) Name() string {
+	return "toolkit:optimistic_lock"
+}
+
+func (p *OptimisticLockPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	errs := []error{
+		cb.Create().Before("gorm:create").Register(p.Name()+":before_create", p.beforeCreate),
+		cb.Update().Before("gorm:update").Register(p.Name()+":before_update", p.beforeUpdate),
+		cb.Update().After("gorm:update").Register(p.Name()+":after_update", p.afterUpdate),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *OptimisticLockPlugin) beforeCreate(db *gorm.DB) {
+	field := versionField(db)
+	if field == nil {
+		return
+	}
+
+	eachRecord(db, func(rv reflect.Value) {
+		if _, zero := field.ValueOf(db.Statement.Context, rv); zero {
+			db.AddError(field.Set(db.Statement.Context, rv, 1))
+		}
+	})
+}
+
+func (p *OptimisticLockPlugin) beforeUpdate(db *gorm.DB) {
+	field := versionField(db)
+	if field == nil || db.Statement.SkipHooks || db.Statement.ReflectValue.Kind() != reflect.Struct {
+		return
+	}
+
+	// batch updates without a loaded record are not version checked
+	for _, pk := range db.Statement.Schema.PrimaryFields {
+		if _, zero := pk.ValueOf(db.Statement.Context, db.Statement.ReflectValue); zero {
+			return
+		}
+	}
+
+	value, _ := field.ValueOf(db.Statement.Context, db.Statement.ReflectValue)
+	current, ok := value.(int64)
+	if !ok {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: current},
+	}})
+	db.Statement.SetColumn(field.DBName, current+1, true)
+	selectColumn(db, field.DBName)
+	db.InstanceSet(versionCheckKey, current)
+}
+
+func (p *OptimisticLockPlugin) afterUpdate(db *gorm.DB) {
+	previous, ok := db.InstanceGet(versionCheckKey)
+	if !ok || db.Error != nil || db.DryRun || db.RowsAffected > 0 {
+		return
+	}
+
+	if field := versionField(db); field != nil {
+		_ = field.Set(db.Statement.Context, db.Statement.ReflectValue, previous)
+	}
+	db.AddError(ErrVersionConflict)
+}
+
+func versionField(db *gorm.DB) *schema.Field {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil
+	}
+	return db.Statement.Schema.LookUpField("Version")
+}
+
+func auditUser(db *gorm.DB) (string, bool) {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Context == nil {
+		return "", false
+	}
+	userID, ok := auth.GetUserID(db.Statement.Context)
+	return userID, ok && userID != ""
+}
+
+// eachRecord - calls fn for the single record or every record of a batch
+func eachRecord(db *gorm.DB, fn func(rv reflect.Value)) {
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if elem := reflect.Indirect(rv.Index(i)); elem.Kind() == reflect.Struct {
+				fn(elem)
+			}
+		}
+	case reflect.Struct:
+		fn(rv)
+	}
+}
+
+// selectColumn - makes sure the column is updated when only selected columns are
+func selectColumn(db *gorm.DB, column string) {
+	selects := db.Statement.Selects
+	if len(selects) == 0 {
+		return
+	}
+	for _, s := range selects {
+		if s == "*" || s == column {
+			return
+		}
+	}
+	db.Statement.Selects = append(selects, column)
+}
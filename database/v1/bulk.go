@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+// insertedColumn - true for rows inserted and false for rows updated by an upsert
+const insertedColumn = "(xmax = 0) AS inserted"
+
+// BulkResult - number of rows inserted and updated by a bulk operation
+type BulkResult struct {
+	Inserted int64
+	Updated  int64
+}
+
+// BulkOption - configures BulkUpsert and CopyFrom
+type BulkOption func(*bulkConfig)
+
+type bulkConfig struct {
+	batchSize int
+	conflict  []string
+	update    []string
+	doNothing bool
+}
+
+// WithBulkBatchSize - sets the number of rows per INSERT statement
+func WithBulkBatchSize(size int) BulkOption {
+	return func(c *bulkConfig) {
+		c.batchSize = size
+	}
+}
+
+// WithConflictColumns - sets the conflict target, defaults to the primary key
+func WithConflictColumns(columns ...string) BulkOption {
+	return func(c *bulkConfig) {
+		c.conflict = columns
+	}
+}
+
+// WithUpdateColumns - sets the columns updated on conflict, defaults to all inserted columns
+func WithUpdateColumns(columns ...string) BulkOption {
+	return func(c *bulkConfig) {
+		c.update = columns
+	}
+}
+
+// WithConflictIgnore - skips conflicting rows instead of updating them
+func WithConflictIgnore() BulkOption {
+	return func(c *bulkConfig) {
+		c.doNothing = true
+	}
+}
+
+func newBulkConfig(opts []BulkOption) bulkConfig {
+	c := bulkConfig{batchSize: 1000}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.batchSize <= 0 {
+		c.batchSize = 1000
+	}
+	return c
+}
+
+// BulkUpsert - inserts the records in batches of INSERT ... ON CONFLICT statements.
+// Plugins and the BeforeSave and BeforeCreate hooks apply before a batch is built, the
+// AfterCreate and AfterSave hooks only once it is written. Values generated by the
+// database are not written back. Batches run in the transaction of the context if any,
+// otherwise each batch commits on its own.
+func BulkUpsert[T any](ctx context.Context, db *gorm.DB, items []T, opts ...BulkOption) (BulkResult, error) {
+	c := newBulkConfig(opts)
+
+	onConflict := clause.OnConflict{DoNothing: c.doNothing}
+	for _, column := range c.conflict {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+	if !c.doNothing {
+		if len(c.update) > 0 {
+			onConflict.DoUpdates = clause.AssignmentColumns(c.update)
+		} else {
+			onConflict.UpdateAll = true
+		}
+	}
+
+	var result BulkResult
+	for start := 0; start < len(items); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(items) {
+			end = len(items)
+		}
+		batch := items[start:end]
+
+		tx := Conn(ctx, db)
+		if err := runHooks(tx, batch, beforeCreateHooks); err != nil {
+			return result, err
+		}
+
+		// the statement is only built to execute it with the inserted flag as result,
+		// the hooks of the records run around the execution instead
+		stmt := tx.
+			Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true, SkipHooks: true}).
+			Clauses(onConflict, clause.Returning{Columns: []clause.Column{{Name: insertedColumn, Raw: true}}}).
+			Create(&batch)
+		if stmt.Error != nil {
+			return result, stmt.Error
+		}
+
+		rows, err := tx.Raw(stmt.Statement.SQL.String(), stmt.Statement.Vars...).Rows()
+		if err != nil {
+			return result, err
+		}
+		err = countUpserted(rows, &result)
+		if err != nil {
+			return result, err
+		}
+
+		if err = runHooks(tx, batch, afterCreateHooks); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// beforeCreateHooks, afterCreateHooks - hooks of a record in the order gorm calls them on Create
+func beforeCreateHooks(tx *gorm.DB, record interface{}) error {
+	if hook, ok := record.(callbacks.BeforeSaveInterface); ok {
+		if err := hook.BeforeSave(tx); err != nil {
+			return err
+		}
+	}
+	if hook, ok := record.(callbacks.BeforeCreateInterface); ok {
+		return hook.BeforeCreate(tx)
+	}
+	return nil
+}
+
+func afterCreateHooks(tx *gorm.DB, record interface{}) error {
+	if hook, ok := record.(callbacks.AfterCreateInterface); ok {
+		if err := hook.AfterCreate(tx); err != nil {
+			return err
+		}
+	}
+	if hook, ok := record.(callbacks.AfterSaveInterface); ok {
+		return hook.AfterSave(tx)
+	}
+	return nil
+}
+
+// runHooks - calls the hooks for the records, which are pointers already or addressed
+func runHooks[T any](tx *gorm.DB, records []T, hooks func(tx *gorm.DB, record interface{}) error) error {
+	session := tx.Session(&gorm.Session{NewDB: true})
+	for i := range records {
+		var record interface{} = &records[i]
+		if reflect.ValueOf(records[i]).Kind() == reflect.Pointer {
+			record = records[i]
+		}
+		if err := hooks(session, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyFrom - streams the rows into the table via COPY FROM on a dedicated connection,
+// e.g. from pgx.CopyFromRows or pgx.CopyFromSlice. With a conflict option the rows are
+// copied into a temporary table and upserted from there, all in one transaction.
+// Hooks and plugins do not apply, including the tenant scope of the TenancyPlugin.
+func CopyFrom(ctx context.Context, db *gorm.DB, table string, columns []string, rows pgx.CopyFromSource, opts ...BulkOption) (BulkResult, error) {
+	c := newBulkConfig(opts)
+	upsert := c.doNothing || len(c.conflict) > 0 || len(c.update) > 0
+	if upsert && !c.doNothing && len(c.conflict) == 0 {
+		return BulkResult{}, errors.New("conflict columns are required to update on conflict")
+	}
+
+	conn, err := dedicatedConn(ctx, db)
+	if err != nil {
+		return BulkResult{}, err
+	}
+	defer conn.Close()
+
+	var result BulkResult
+	err = conn.Raw(func(driverConn interface{}) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("COPY FROM requires the pgx driver, got %T", driverConn)
+		}
+		pgxConn := stdlibConn.Conn()
+		if !upsert {
+			n, err := pgxConn.CopyFrom(ctx, pgx.Identifier(strings.Split(table, ".")), columns, rows)
+			result.Inserted = n
+			return err
+		}
+
+		return pgxConn.BeginFunc(ctx, func(tx pgx.Tx) error {
+			staging := "bulk_staging"
+			_, err := tx.Exec(ctx, fmt.Sprintf(
+				"CREATE TEMPORARY TABLE %s (LIKE %s INCLUDING DEFAULTS) ON COMMIT DROP",
+				staging, quoteIdentifier(table),
+			))
+			if err != nil {
+				return err
+			}
+			if _, err = tx.CopyFrom(ctx, pgx.Identifier{staging}, columns, rows); err != nil {
+				return err
+			}
+
+			upserted, err := tx.Query(ctx, upsertFromSQL(table, staging, columns, c))
+			if err != nil {
+				return err
+			}
+			defer upserted.Close()
+			for upserted.Next() {
+				var inserted bool
+				if err = upserted.Scan(&inserted); err != nil {
+					return err
+				}
+				result.add(inserted)
+			}
+			return upserted.Err()
+		})
+	})
+
+	return result, err
+}
+
+// upsertFromSQL - moves the rows of the staging table into the table
+func upsertFromSQL(table, staging string, columns []string, c bulkConfig) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+	list := strings.Join(quoted, ", ")
+
+	update := c.update
+	if len(update) == 0 {
+		update = exclude(columns, c.conflict)
+	}
+
+	// without columns left to update the conflicting rows are skipped
+	action := "DO NOTHING"
+	if !c.doNothing && len(update) > 0 {
+		set := make([]string, len(update))
+		for i, column := range update {
+			set[i] = fmt.Sprintf("%s = EXCLUDED.%s", quoteIdentifier(column), quoteIdentifier(column))
+		}
+		action = "DO UPDATE SET " + strings.Join(set, ", ")
+	}
+
+	target := make([]string, len(c.conflict))
+	for i, column := range c.conflict {
+		target[i] = quoteIdentifier(column)
+	}
+	conflict := "ON CONFLICT"
+	if len(target) > 0 {
+		conflict += " (" + strings.Join(target, ", ") + ")"
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) SELECT %s FROM %s %s %s RETURNING %s",
+		quoteIdentifier(table), list, list, staging, conflict, action, insertedColumn,
+	)
+}
+
+func countUpserted(rows *sql.Rows, result *BulkResult) error {
+	defer rows.Close()
+	for rows.Next() {
+		var inserted bool
+		if err := rows.Scan(&inserted); err != nil {
+			return err
+		}
+		result.add(inserted)
+	}
+	return rows.Err()
+}
+
+func (r *BulkResult) add(inserted bool) {
+	if inserted {
+		r.Inserted++
+	} else {
+		r.Updated++
+	}
+}
+
+func exclude(columns, excluded []string) []string {
+	var rest []string
+	for _, column := range columns {
+		skip := false
+		for _, e := range excluded {
+			if column == e {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			rest = append(rest, column)
+		}
+	}
+	return rest
+}
@@ -1,24 +1,53 @@
 package database
 
 import (
-	"fmt"
+	"errors"
+	"net"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 )
 
-const dsnTemplate = "host=%s port=%s user=%s dbname=%s password=%s sslmode=%s search_path=%s"
+// Option - configures Connect
+type Option func(*options)
 
-func Connect(db ConnectionConfig, c Config) *gorm.DB {
-	dsn := fmt.Sprintf(dsnTemplate, db.PostgresHostname, db.PostgresPort, db.PostgresUser, db.PostgresDBName, db.PostgresPassword, db.PostgresSSLMode, db.PostgresSchema)
-	pgDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+type options struct {
+	logger  *zap.Logger
+	plugins []gorm.Plugin
+}
+
+// WithLogger - writes the queries through the zap logger instead of the gorm default logger
+func WithLogger(log *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = log
+	}
+}
+
+// WithPlugins - registers gorm plugins, e.g. the metrics or tracing plugin
+func WithPlugins(plugins ...gorm.Plugin) Option {
+	return func(o *options) {
+		o.plugins = append(o.plugins, plugins...)
+	}
+}
+
+func Connect(db ConnectionConfig, c Config, opts ...Option) *gorm.DB {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	log, err := gormLogger(c, o.logger)
 	if err != nil {
 		panic(err)
 	}
 
-	sqlDb, err := pgDB.DB()
+	pgDB, err := gorm.Open(postgres.Open(db.DSN()), &gorm.Config{Logger: log})
 	if err != nil {
 		panic(err)
 	}
@@ -33,9 +62,138 @@ func Connect(db ConnectionConfig, c Config) *gorm.DB {
 		panic(err)
 	}
 
+	if len(db.PostgresReplicaHosts) > 0 {
+		resolver, err := replicaResolver(db, c)
+		if err != nil {
+			panic(err)
+		}
+
+		resolver.SetMaxIdleConns(maxIdleCons).SetMaxOpenConns(maxOpenCons).SetConnMaxLifetime(time.Hour)
+		err = pgDB.Use(resolver)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, plugin := range o.plugins {
+		err = pgDB.Use(plugin)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	sqlDb, err := pgDB.DB()
+	if err != nil {
+		panic(err)
+	}
+
 	sqlDb.SetMaxIdleConns(maxIdleCons)
 	sqlDb.SetMaxOpenConns(maxOpenCons)
 	sqlDb.SetConnMaxLifetime(time.Hour)
 
 	return pgDB
 }
+
+func gormLogger(c Config, log *zap.Logger) (gormlogger.Interface, error) {
+	level, err := parseLogLevel(c.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	if log == nil {
+		return gormlogger.Default.LogMode(level), nil
+	}
+
+	var slowThreshold time.Duration
+	if c.SlowQueryThreshold != "" {
+		slowThreshold, err = time.ParseDuration(c.SlowQueryThreshold)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var logParameters bool
+	if c.LogParameters != "" {
+		logParameters, err = strconv.ParseBool(c.LogParameters)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewGormLogger(log, level, slowThreshold, logParameters), nil
+}
+
+// DSN - builds the connection string, values are quoted so they may contain spaces or quotes
+func (db ConnectionConfig) DSN() string {
+	if db.DatabaseURL != "" {
+		return db.DatabaseURL
+	}
+
+	params := [][2]string{
+		{"host", db.PostgresHostname},
+		{"port", db.PostgresPort},
+		{"user", db.PostgresUser},
+		{"dbname", db.PostgresDBName},
+		{"password", db.PostgresPassword},
+		{"sslmode", db.PostgresSSLMode},
+		{"sslrootcert", db.PostgresSSLRootCert},
+		{"sslcert", db.PostgresSSLCert},
+		{"sslkey", db.PostgresSSLKey},
+		{"search_path", db.PostgresSchema},
+		{"application_name", db.PostgresApplicationName},
+		{"connect_timeout", db.PostgresConnectTimeout},
+		{"statement_timeout", db.PostgresStatementTimeout},
+	}
+
+	var dsn strings.Builder
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		if dsn.Len() > 0 {
+			dsn.WriteByte(' ')
+		}
+		dsn.WriteString(param[0])
+		dsn.WriteString("=")
+		dsn.WriteString(quoteDSNValue(param[1]))
+	}
+
+	return dsn.String()
+}
+
+// withHost - returns a copy of the config pointing to another host, given as `host` or `host:port`.
+// A DATABASE_URL is only rewritten in URL form, keyword/value connection strings are rejected.
+func (db ConnectionConfig) withHost(host string) (ConnectionConfig, error) {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, ""
+	}
+
+	if db.DatabaseURL != "" {
+		u, err := url.Parse(db.DatabaseURL)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			return db, errors.New("replica hosts require DATABASE_URL to be a postgres:// or postgresql:// URL")
+		}
+		if port == "" {
+			port = u.Port()
+		}
+		u.Host = hostname
+		if port != "" {
+			u.Host = net.JoinHostPort(hostname, port)
+		}
+		db.DatabaseURL = u.String()
+		return db, nil
+	}
+
+	db.PostgresHostname = hostname
+	if port != "" {
+		db.PostgresPort = port
+	}
+	return db, nil
+}
+
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
@@ -0,0 +1,266 @@
+// Package dbtest - isolated Postgres databases for integration tests
+package dbtest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	database "github.com/tjarkmeyer/golang-toolkit/database/v1"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	templatesMu sync.Mutex
+	templates   = make(map[string]bool)
+)
+
+// Option - configures New
+type Option func(*config)
+
+type config struct {
+	migrations   fs.FS
+	migratorOpts []database.MigratorOption
+	schemaMode   bool
+}
+
+// WithMigrations - applies the migrations of the file system to every test database
+func WithMigrations(fsys fs.FS, opts ...database.MigratorOption) Option {
+	return func(c *config) {
+		c.migrations = fsys
+		c.migratorOpts = opts
+	}
+}
+
+// WithSchemaIsolation - isolates tests by a throwaway schema in the database of the DSN
+// instead of a throwaway database
+func WithSchemaIsolation() Option {
+	return func(c *config) {
+		c.schemaMode = true
+	}
+}
+
+// New - returns a connection to a throwaway database which is dropped when the test ends.
+// Databases are cloned from a template holding the migrations, built once per migration set.
+func New(t testing.TB, dsn string, opts ...Option) *gorm.DB {
+	t.Helper()
+
+	var c config
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	admin, err := open(dsn)
+	if err != nil {
+		t.Fatalf("dbtest: connecting to %s: %v", redact(dsn), err)
+	}
+	t.Cleanup(func() { closeDB(admin) })
+
+	if c.schemaMode {
+		return newSchema(t, admin, dsn, c)
+	}
+	return newDatabase(t, admin, dsn, c)
+}
+
+// NewTx - returns a transaction which is rolled back when the test ends, together
+// with a context carrying it so code using database.Conn or database.RunInTx joins it
+func NewTx(t testing.TB, db *gorm.DB) (context.Context, *gorm.DB) {
+	t.Helper()
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatalf("dbtest: beginning transaction: %v", tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+
+	return database.ContextWithTx(context.Background(), tx), tx
+}
+
+func newDatabase(t testing.TB, admin *gorm.DB, dsn string, c config) *gorm.DB {
+	t.Helper()
+
+	dbName := name("db")
+	create := "CREATE DATABASE " + quote(dbName)
+	if c.migrations != nil {
+		template, err := buildTemplate(admin, dsn, c)
+		if err != nil {
+			t.Fatalf("dbtest: building template database: %v", err)
+		}
+		create += " TEMPLATE " + quote(template)
+	}
+
+	if err := admin.Exec(create).Error; err != nil {
+		t.Fatalf("dbtest: creating database: %v", err)
+	}
+
+	db, err := open(withParam(dsn, "dbname", dbName))
+	if err != nil {
+		t.Fatalf("dbtest: connecting to test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		closeDB(db)
+		if err := admin.Exec("DROP DATABASE IF EXISTS " + quote(dbName) + " WITH (FORCE)").Error; err != nil {
+			t.Errorf("dbtest: dropping database %s: %v", dbName, err)
+		}
+	})
+
+	return db
+}
+
+func newSchema(t testing.TB, admin *gorm.DB, dsn string, c config) *gorm.DB {
+	t.Helper()
+
+	schema := name("schema")
+	if err := admin.Exec("CREATE SCHEMA " + quote(schema)).Error; err != nil {
+		t.Fatalf("dbtest: creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP SCHEMA IF EXISTS " + quote(schema) + " CASCADE").Error; err != nil {
+			t.Errorf("dbtest: dropping schema %s: %v", schema, err)
+		}
+	})
+
+	db, err := open(withParam(dsn, "search_path", schema))
+	if err != nil {
+		t.Fatalf("dbtest: connecting to test schema: %v", err)
+	}
+	t.Cleanup(func() { closeDB(db) })
+
+	if c.migrations != nil {
+		if err := migrate(db, c); err != nil {
+			t.Fatalf("dbtest: migrating test schema: %v", err)
+		}
+	}
+
+	return db
+}
+
+// buildTemplate - creates the template database of the migration set unless it exists.
+// The advisory lock serializes parallel test binaries building the same template.
+func buildTemplate(admin *gorm.DB, dsn string, c config) (string, error) {
+	template, err := templateName(c)
+	if err != nil {
+		return "", err
+	}
+
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	if templates[template] {
+		return template, nil
+	}
+
+	err = database.WithLock(context.Background(), admin, "dbtest:"+template, func(ctx context.Context) error {
+		var exists bool
+		err := admin.Raw("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = ?)", template).Scan(&exists).Error
+		if err != nil || exists {
+			return err
+		}
+
+		// built under a temporary name so a failed migration never leaves a broken template
+		building := template + "_build"
+		if err = admin.Exec("DROP DATABASE IF EXISTS " + quote(building) + " WITH (FORCE)").Error; err != nil {
+			return err
+		}
+		if err = admin.Exec("CREATE DATABASE " + quote(building)).Error; err != nil {
+			return err
+		}
+
+		db, err := open(withParam(dsn, "dbname", building))
+		if err != nil {
+			return err
+		}
+		err = migrate(db, c)
+		closeDB(db)
+		if err != nil {
+			return err
+		}
+
+		return admin.Exec("ALTER DATABASE " + quote(building) + " RENAME TO " + quote(template)).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	templates[template] = true
+	return template, nil
+}
+
+func migrate(db *gorm.DB, c config) error {
+	migrator, err := database.NewMigrator(db, c.migrations, c.migratorOpts...)
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(context.Background())
+	return err
+}
+
+// templateName - derives the template name from the content of the migrations
+func templateName(c config) (string, error) {
+	migrator, err := database.NewMigrator(nil, c.migrations, c.migratorOpts...)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, migration := range migrator.Migrations() {
+		fmt.Fprintf(h, "%d\x00%s\x00%s\x00", migration.Version, migration.Name, migration.Up)
+	}
+	return "dbtest_tmpl_" + hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+func open(dsn string) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+}
+
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+}
+
+// withParam - overrides a connection parameter of a URL or key/value DSN
+func withParam(dsn, key, value string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err == nil {
+			if key == "dbname" {
+				u.Path = "/" + value
+			} else {
+				query := u.Query()
+				query.Set(key, value)
+				u.RawQuery = query.Encode()
+			}
+			return u.String()
+		}
+	}
+	// later parameters override earlier ones
+	return dsn + " " + key + "='" + value + "'"
+}
+
+func name(kind string) string {
+	id := uuid.Must(uuid.NewV4())
+	return "dbtest_" + kind + "_" + hex.EncodeToString(id.Bytes())[:16]
+}
+
+func quote(identifier string) string {
+	return `"` + identifier + `"`
+}
+
+func redact(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return "database"
+}
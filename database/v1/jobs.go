@@ -0,0 +1,435 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// ErrUnknownJob - returned when a job of an unregistered kind is claimed
+var ErrUnknownJob = errors.New("no handler registered for job kind")
+
+// Job - background job stored in the jobs table
+type Job struct {
+	ID          uuid.UUID       `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Kind        string          `gorm:"not null" json:"kind"`
+	Payload     json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	Priority    int             `gorm:"not null;default:0" json:"priority"`
+	UniqueKey   *string         `gorm:"uniqueIndex:idx_jobs_unique_key,where:status IN ('queued'\\,'running')" json:"uniqueKey,omitempty"`
+	Status      string          `gorm:"not null;default:queued;index:idx_jobs_due,priority:1" json:"status"`
+	RunAt       time.Time       `gorm:"not null;index:idx_jobs_due,priority:2" json:"runAt"`
+	Attempts    int             `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int             `gorm:"not null;default:10" json:"maxAttempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	LockedUntil *time.Time      `json:"lockedUntil,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// Decode - unmarshals the payload of the job
+func (j Job) Decode(v interface{}) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// JobHandler - processes a job, returning an error schedules a retry
+type JobHandler func(ctx context.Context, job Job) error
+
+// MigrateJobs - creates the jobs table
+func MigrateJobs(db *gorm.DB) error {
+	return db.AutoMigrate(&Job{})
+}
+
+// JobOption - configures an enqueued job
+type JobOption func(*Job)
+
+// RunAt - delays the job until the given time
+func RunAt(t time.Time) JobOption {
+	return func(j *Job) {
+		j.RunAt = t
+	}
+}
+
+// WithPriority - jobs with higher priority are claimed first
+func WithPriority(priority int) JobOption {
+	return func(j *Job) {
+		j.Priority = priority
+	}
+}
+
+// WithUniqueKey - skips the job while another queued or running job has the same key
+func WithUniqueKey(key string) JobOption {
+	return func(j *Job) {
+		j.UniqueKey = &key
+	}
+}
+
+// WithMaxAttempts - sets how often the job is attempted before it fails
+func WithMaxAttempts(n int) JobOption {
+	return func(j *Job) {
+		j.MaxAttempts = n
+	}
+}
+
+// EnqueueJob - stores a job using the transaction of the context.
+// Returns false if the job was skipped because of its unique key.
+func EnqueueJob(ctx context.Context, db *gorm.DB, kind string, payload interface{}, opts ...JobOption) (bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+
+	job := &Job{
+		Kind:        kind,
+		Payload:     data,
+		Status:      JobQueued,
+		RunAt:       time.Now(),
+		MaxAttempts: 10,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	result := Conn(ctx, db).Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "unique_key"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "status IN ('queued','running')"}}},
+		DoNothing:   true,
+	}).Create(job)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// WorkerOption - configures a WorkerPool
+type WorkerOption func(*WorkerPool)
+
+// WithConcurrency - sets the number of jobs processed in parallel
+func WithConcurrency(n int) WorkerOption {
+	return func(p *WorkerPool) {
+		p.concurrency = n
+	}
+}
+
+// WithJobTimeout - sets how long a job may run
+func WithJobTimeout(timeout time.Duration) WorkerOption {
+	return func(p *WorkerPool) {
+		p.timeout = timeout
+	}
+}
+
+// WithJobPollInterval - sets the pause of an idle worker between polls
+func WithJobPollInterval(interval time.Duration) WorkerOption {
+	return func(p *WorkerPool) {
+		p.pollInterval = interval
+	}
+}
+
+// WithJobBackoff - sets the bounds of the exponential backoff between attempts
+func WithJobBackoff(minBackoff, maxBackoff time.Duration) WorkerOption {
+	return func(p *WorkerPool) {
+		p.minBackoff = minBackoff
+		p.maxBackoff = maxBackoff
+	}
+}
+
+// WorkerPool - processes queued jobs with a fixed number of workers
+type WorkerPool struct {
+	db           *gorm.DB
+	logger       *zap.Logger
+	handlers     map[string]JobHandler
+	concurrency  int
+	timeout      time.Duration
+	pollInterval time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	stop         chan struct{}
+	stopOnce     sync.Once
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+// NewWorkerPool - creates a worker pool, handlers have to be registered before Start
+func NewWorkerPool(db *gorm.DB, logger *zap.Logger, opts ...WorkerOption) *WorkerPool {
+	p := &WorkerPool{
+		db:           db,
+		logger:       logger,
+		handlers:     make(map[string]JobHandler),
+		concurrency:  4,
+		timeout:      5 * time.Minute,
+		pollInterval: time.Second,
+		minBackoff:   time.Second,
+		maxBackoff:   time.Hour,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Register - sets the handler of a job kind
+func (p *WorkerPool) Register(kind string, handler JobHandler) {
+	p.handlers[kind] = handler
+}
+
+// Start - starts the workers, running jobs keep the values but not the cancellation of ctx
+func (p *WorkerPool) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(detached{ctx})
+	p.stop = make(chan struct{})
+
+	for i := 0; i < p.concurrency; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+}
+
+// Shutdown - stops claiming jobs and waits for running jobs.
+// Running jobs are cancelled when ctx expires first.
+func (p *WorkerPool) Shutdown(ctx context.Context) error {
+	if p.stop == nil {
+		return nil
+	}
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (p *WorkerPool) work(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		job, err := p.claim(ctx)
+		if err != nil {
+			p.logger.Error("[ERROR] claiming job", zap.Error(err))
+		}
+		if job != nil {
+			p.run(ctx, job)
+			continue
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.pollInterval):
+		}
+	}
+}
+
+// claim - locks the next due job, including running jobs whose lock expired
+func (p *WorkerPool) claim(ctx context.Context) (*Job, error) {
+	kinds := make([]string, 0, len(p.handlers))
+	for kind := range p.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	var jobs []Job
+	err := RunInTx(ctx, p.db, func(ctx context.Context, tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("kind IN ?", kinds).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?)", JobQueued, now, JobRunning, now).
+			Order("priority DESC, run_at").
+			Limit(1).
+			Find(&jobs).Error
+		if err != nil || len(jobs) == 0 {
+			return err
+		}
+
+		lockedUntil := now.Add(p.timeout)
+		jobs[0].Status = JobRunning
+		jobs[0].Attempts++
+		jobs[0].LockedUntil = &lockedUntil
+		return tx.Model(&jobs[0]).Updates(map[string]interface{}{
+			"status":       JobRunning,
+			"attempts":     jobs[0].Attempts,
+			"locked_until": lockedUntil,
+		}).Error
+	})
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+func (p *WorkerPool) run(ctx context.Context, job *Job) {
+	log := p.logger.With(zap.String("job_id", job.ID.String()), zap.String("kind", job.Kind), zap.Int("attempts", job.Attempts))
+
+	err := p.handle(ctx, job)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       JobDone,
+		"locked_until": nil,
+		"finished_at":  now,
+	}
+
+	if err != nil {
+		updates["last_error"] = err.Error()
+		if job.Attempts >= job.MaxAttempts {
+			log.Error("[ERROR] job failed permanently", zap.Error(err))
+			updates["status"] = JobFailed
+		} else {
+			log.Warn("[RETRY] job failed", zap.Error(err))
+			updates["status"] = JobQueued
+			updates["finished_at"] = nil
+			updates["run_at"] = now.Add(backoff(job.Attempts, p.minBackoff, p.maxBackoff))
+		}
+	}
+
+	// the outcome is stored even if the pool is shutting down
+	err = p.db.WithContext(detached{ctx}).Model(job).Updates(updates).Error
+	if err != nil {
+		log.Error("[ERROR] storing job result", zap.Error(err))
+	}
+}
+
+func (p *WorkerPool) handle(ctx context.Context, job *Job) (err error) {
+	handler, ok := p.handlers[job.Kind]
+	if !ok {
+		return ErrUnknownJob
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, *job)
+}
+
+// Scheduler - enqueues recurring jobs from cron expressions.
+// The next run is enqueued ahead of time with a unique key,
+// so several replicas running the same scheduler create it only once.
+type Scheduler struct {
+	db      *gorm.DB
+	logger  *zap.Logger
+	entries []scheduleEntry
+}
+
+type scheduleEntry struct {
+	schedule cron.Schedule
+	kind     string
+	payload  interface{}
+	opts     []JobOption
+	enqueued time.Time
+}
+
+// NewScheduler - creates a scheduler for recurring jobs
+func NewScheduler(db *gorm.DB, logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Add - schedules a job by a standard five field cron expression, e.g. `*/5 * * * *`
+func (s *Scheduler) Add(spec, kind string, payload interface{}, opts ...JobOption) error {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return err
+	}
+
+	s.entries = append(s.entries, scheduleEntry{
+		schedule: schedule,
+		kind:     kind,
+		payload:  payload,
+		opts:     opts,
+	})
+	return nil
+}
+
+// Run - enqueues the scheduled jobs until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		now := time.Now()
+		wake := now.Add(time.Minute)
+
+		for i := range s.entries {
+			entry := &s.entries[i]
+			next := entry.schedule.Next(now)
+			if next.Before(wake) {
+				wake = next
+			}
+			if next.Equal(entry.enqueued) {
+				continue
+			}
+
+			key := fmt.Sprintf("cron:%s:%d", entry.kind, next.Unix())
+			opts := append(append([]JobOption{}, entry.opts...), RunAt(next), WithUniqueKey(key))
+			_, err := EnqueueJob(ctx, s.db, entry.kind, entry.payload, opts...)
+			if err != nil {
+				s.logger.Error("[ERROR] enqueueing scheduled job", zap.String("kind", entry.kind), zap.Error(err))
+				continue
+			}
+			entry.enqueued = next
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(wake) + time.Millisecond):
+		}
+	}
+}
+
+// detached - keeps the values of the parent context but not its cancellation
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
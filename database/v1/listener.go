@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Notification - payload received on a Postgres channel
+type Notification struct {
+	Channel string
+	Payload string
+}
+
+// Listener - subscribes to Postgres channels via LISTEN on a dedicated connection
+// and reconnects automatically when the connection is lost
+type Listener struct {
+	dsn     string
+	logger  *zap.Logger
+	mu      sync.Mutex
+	subs    map[string][]chan Notification
+	changed chan struct{}
+}
+
+// NewListener - creates a listener for the database of the connection config
+func NewListener(db ConnectionConfig, logger *zap.Logger) *Listener {
+	return &Listener{
+		dsn:     db.DSN(),
+		logger:  logger,
+		subs:    make(map[string][]chan Notification),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Listen - subscribes to the channel, the returned channel is closed when Run returns
+func (l *Listener) Listen(channel string) <-chan Notification {
+	ch := make(chan Notification, 64)
+
+	l.mu.Lock()
+	l.subs[channel] = append(l.subs[channel], ch)
+	l.mu.Unlock()
+
+	select {
+	case l.changed <- struct{}{}:
+	default:
+	}
+	return ch
+}
+
+// Subscribe - subscribes to the channel and decodes the JSON payloads into T,
+// payloads which cannot be decoded are logged and skipped
+func Subscribe[T any](l *Listener, channel string) <-chan T {
+	notifications := l.Listen(channel)
+	out := make(chan T, cap(notifications))
+
+	go func() {
+		defer close(out)
+		for n := range notifications {
+			var v T
+			if err := json.Unmarshal([]byte(n.Payload), &v); err != nil {
+				l.logger.Error("[ERROR] decoding notification payload", zap.String("channel", channel), zap.Error(err))
+				continue
+			}
+			out <- v
+		}
+	}()
+
+	return out
+}
+
+// Run - receives notifications until the context is cancelled
+func (l *Listener) Run(ctx context.Context) error {
+	defer l.closeSubscriptions()
+
+	for attempt := 1; ; attempt++ {
+		connected, err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			attempt = 1
+		}
+
+		l.logger.Warn("[RECONNECT] listener connection lost", zap.Int("attempt", attempt), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff(attempt, 100*time.Millisecond, 30*time.Second)):
+		}
+	}
+}
+
+// listen - listens on one connection until it fails, reports whether it connected at all
+func (l *Listener) listen(ctx context.Context) (bool, error) {
+	conn, err := pgx.Connect(ctx, l.dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	listening := make(map[string]bool)
+	for {
+		for _, channel := range l.channels() {
+			if listening[channel] {
+				continue
+			}
+			if _, err = conn.Exec(ctx, "LISTEN "+quoteIdentifier(channel)); err != nil {
+				return true, err
+			}
+			listening[channel] = true
+		}
+
+		// wake up when new channels are subscribed, the watcher has exited
+		// before the next iteration so a consumed signal is never lost
+		waitCtx, cancel := context.WithCancel(ctx)
+		watching := make(chan struct{})
+		go func() {
+			defer close(watching)
+			select {
+			case <-l.changed:
+				cancel()
+			case <-waitCtx.Done():
+			}
+		}()
+
+		n, err := conn.WaitForNotification(waitCtx)
+		interrupted := waitCtx.Err() != nil
+		cancel()
+		<-watching
+
+		if err != nil {
+			if interrupted && ctx.Err() == nil && errors.Is(err, context.Canceled) {
+				continue
+			}
+			return true, err
+		}
+		l.dispatch(ctx, Notification{Channel: n.Channel, Payload: n.Payload})
+	}
+}
+
+func (l *Listener) dispatch(ctx context.Context, n Notification) {
+	l.mu.Lock()
+	subs := append([]chan Notification{}, l.subs[n.Channel]...)
+	l.mu.Unlock()
+
+	for _, ch := range subs {
+		select {
+		case ch <- n:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *Listener) channels() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	channels := make([]string, 0, len(l.subs))
+	for channel := range l.subs {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+func (l *Listener) closeSubscriptions() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for channel, subs := range l.subs {
+		for _, ch := range subs {
+			close(ch)
+		}
+		delete(l.subs, channel)
+	}
+}
+
+// Notify - sends the JSON encoded payload to the channel. Within a transaction
+// of the context the notification is only delivered when it commits.
+func Notify(ctx context.Context, db *gorm.DB, channel string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	// the statement starts with SELECT and would be routed to a replica otherwise
+	return UsePrimary(Conn(ctx, db)).Exec("SELECT pg_notify(?, ?)", channel, string(data)).Error
+}
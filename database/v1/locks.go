@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Lock - session advisory lock held on a dedicated connection
+type Lock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// TryLock - acquires the lock without waiting, returns false if another session holds it
+func TryLock(ctx context.Context, db *gorm.DB, name string) (*Lock, bool, error) {
+	conn, err := dedicatedConn(ctx, db)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := advisoryLockKey("lock:" + name)
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Close()
+		return nil, false, err
+	}
+
+	return &Lock{conn: conn, key: key}, true, nil
+}
+
+// AcquireLock - waits until the lock is acquired or the context is done
+func AcquireLock(ctx context.Context, db *gorm.DB, name string) (*Lock, error) {
+	conn, err := dedicatedConn(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	key := advisoryLockKey("lock:" + name)
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Lock{conn: conn, key: key}, nil
+}
+
+// WithLock - runs fn while holding the lock
+func WithLock(ctx context.Context, db *gorm.DB, name string, fn func(ctx context.Context) error) error {
+	lock, err := AcquireLock(ctx, db, name)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock(context.Background())
+
+	return fn(ctx)
+}
+
+// Unlock - releases the lock and its connection. If the lock cannot be released,
+// e.g. because ctx is already done, the connection is discarded instead of being
+// returned to the pool, closing the session releases the lock as well.
+func (l *Lock) Unlock(ctx context.Context) error {
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+	if err != nil {
+		_ = l.conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+		return err
+	}
+	return l.conn.Close()
+}
+
+// Alive - reports whether the connection holding the lock is still alive
+func (l *Lock) Alive(ctx context.Context) bool {
+	return l.conn.PingContext(ctx) == nil
+}
+
+// LeaderElection - elects one leader among replicas via an advisory lock.
+// Leadership is kept as long as the connection holding the lock is alive.
+type LeaderElection struct {
+	db       *gorm.DB
+	name     string
+	interval time.Duration
+	logger   *zap.Logger
+	leader   atomic.Bool
+	events   chan bool
+}
+
+// NewLeaderElection - creates a leader election, interval sets how often
+// the lock is tried as follower and the connection is checked as leader
+func NewLeaderElection(db *gorm.DB, name string, interval time.Duration, logger *zap.Logger) *LeaderElection {
+	return &LeaderElection{
+		db:       db,
+		name:     name,
+		interval: interval,
+		logger:   logger,
+		events:   make(chan bool, 1),
+	}
+}
+
+// Events - receives true when leadership is gained and false when it is lost.
+// The channel has to be drained while Run is active.
+func (e *LeaderElection) Events() <-chan bool {
+	return e.events
+}
+
+// IsLeader - reports whether this instance currently is the leader
+func (e *LeaderElection) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run - campaigns for leadership until the context is cancelled
+func (e *LeaderElection) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	var lock *Lock
+	for {
+		if lock == nil {
+			l, acquired, err := TryLock(ctx, e.db, e.name)
+			if err != nil && ctx.Err() == nil {
+				e.logger.Error("[ERROR] trying leader lock", zap.String("name", e.name), zap.Error(err))
+			}
+			if acquired {
+				lock = l
+				e.setLeader(ctx, true)
+			}
+		} else if !lock.Alive(ctx) && ctx.Err() == nil {
+			e.logger.Warn("[LOST] leader lock connection", zap.String("name", e.name))
+			_ = lock.conn.Close()
+			lock = nil
+			e.setLeader(ctx, false)
+		}
+
+		select {
+		case <-ctx.Done():
+			if lock != nil {
+				_ = lock.Unlock(context.Background())
+				e.leader.Store(false)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *LeaderElection) setLeader(ctx context.Context, leader bool) {
+	e.leader.Store(leader)
+	select {
+	case e.events <- leader:
+	case <-ctx.Done():
+	}
+}
+
+func dedicatedConn(ctx context.Context, db *gorm.DB) (*sql.Conn, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return sqlDB.Conn(ctx)
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GormLogger - gorm logger writing queries through zap
+type GormLogger struct {
+	log           *zap.Logger
+	level         gormlogger.LogLevel
+	slowThreshold time.Duration
+	logParameters bool
+}
+
+// NewGormLogger - creates a gorm logger on top of the zap logger.
+// Query parameters are redacted unless logParameters is set.
+func NewGormLogger(log *zap.Logger, level gormlogger.LogLevel, slowThreshold time.Duration, logParameters bool) *GormLogger {
+	return &GormLogger{
+		log:           log.WithOptions(zap.WithCaller(false)),
+		level:         level,
+		slowThreshold: slowThreshold,
+		logParameters: logParameters,
+	}
+}
+
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	logger := *l
+	logger.level = level
+	return &logger
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.log.Info(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.log.Warn(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.log.Error(fmt.Sprintf(msg, data...), l.fields(ctx)...)
+	}
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	slow := l.slowThreshold > 0 && elapsed > l.slowThreshold
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+
+	switch {
+	case failed && l.level >= gormlogger.Error:
+	case slow && l.level >= gormlogger.Warn:
+	case l.level >= gormlogger.Info:
+	default:
+		return
+	}
+
+	sql, rows := fc()
+	fields := append(l.fields(ctx),
+		zap.String("sql", sql),
+		zap.Duration("duration", elapsed),
+		zap.Int64("rows_affected", rows),
+	)
+
+	switch {
+	case failed:
+		l.log.Error("[ERROR] executing query", append(fields, zap.Error(err))...)
+	case slow:
+		l.log.Warn("[SLOW] query exceeded threshold", append(fields, zap.Duration("threshold", l.slowThreshold))...)
+	default:
+		l.log.Debug("[QUERY] executed query", fields...)
+	}
+}
+
+// ParamsFilter - hides the query parameters from the logged SQL unless enabled
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.logParameters {
+		return sql, params
+	}
+	return sql, nil
+}
+
+func (l *GormLogger) fields(ctx context.Context) []zap.Field {
+	fields := []zap.Field{zap.String("caller", caller())}
+	if ctx == nil {
+		return fields
+	}
+
+	if span := sentry.TransactionFromContext(ctx); span != nil {
+		fields = append(fields,
+			zap.String("trace_id", span.TraceID.String()),
+			zap.String("span_id", span.SpanID.String()),
+		)
+	}
+	return fields
+}
+
+// packagePrefix - prefix of the functions of this package in stack frames
+var packagePrefix = reflect.TypeOf(GormLogger{}).PkgPath() + "."
+
+// caller - returns file and line of the first stack frame outside of gorm and this package
+func caller() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "gorm.io/") && !strings.HasPrefix(frame.Function, packagePrefix) {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// parseLogLevel - maps silent, error, warn and info to the gorm log levels
+func parseLogLevel(level string) (gormlogger.LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "silent":
+		return gormlogger.Silent, nil
+	case "error":
+		return gormlogger.Error, nil
+	case "warn", "":
+		return gormlogger.Warn, nil
+	case "info":
+		return gormlogger.Info, nil
+	default:
+		return gormlogger.Silent, fmt.Errorf("unknown log level %q", level)
+	}
+}
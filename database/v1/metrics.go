@@ -0,0 +1,170 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+const (
+	queryStartKey = "toolkit:query_start"
+	querySpanKey  = "toolkit:query_span"
+)
+
+// MetricsPlugin - exposes the connection pool stats and per-query latencies as prometheus metrics
+type MetricsPlugin struct {
+	registerer prometheus.Registerer
+	dbName     string
+	latency    *prometheus.HistogramVec
+}
+
+// NewMetricsPlugin - creates the metrics plugin registering its collectors at the registerer
+func NewMetricsPlugin(registerer prometheus.Registerer, dbName string) *MetricsPlugin {
+	return &MetricsPlugin{
+		registerer: registerer,
+		dbName:     dbName,
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "gorm_query_duration_seconds",
+			Help:        "Latency of gorm queries by operation and table.",
+			ConstLabels: prometheus.Labels{"db_name": dbName},
+			Buckets:     prometheus.DefBuckets,
+		}, []string{"operation", "table"}),
+	}
+}
+
+func (p *MetricsPlugin) Name() string {
+	return "toolkit:metrics"
+}
+
+func (p *MetricsPlugin) Initialize(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	err = p.registerer.Register(collectors.NewDBStatsCollector(sqlDB, p.dbName))
+	if err != nil {
+		return err
+	}
+
+	err = p.registerer.Register(p.latency)
+	if err != nil {
+		return err
+	}
+
+	return registerAround(db, p.Name(), p.before, p.after)
+}
+
+func (p *MetricsPlugin) before(string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		db.InstanceSet(queryStartKey, time.Now())
+	}
+}
+
+func (p *MetricsPlugin) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		start, ok := db.InstanceGet(queryStartKey)
+		if !ok {
+			return
+		}
+		p.latency.WithLabelValues(operation, table(db)).Observe(time.Since(start.(time.Time)).Seconds())
+	}
+}
+
+// TracingPlugin - creates sentry spans for queries of requests traced via the tracing package
+type TracingPlugin struct{}
+
+// NewTracingPlugin - creates the tracing plugin
+func NewTracingPlugin() *TracingPlugin {
+	return &TracingPlugin{}
+}
+
+func (p *TracingPlugin) Name() string {
+	return "toolkit:tracing"
+}
+
+func (p *TracingPlugin) Initialize(db *gorm.DB) error {
+	return registerAround(db, p.Name(), p.before, p.after)
+}
+
+func (p *TracingPlugin) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || sentry.TransactionFromContext(ctx) == nil {
+			return
+		}
+
+		span := sentry.StartSpan(ctx, "db.sql."+operation)
+		span.SetTag("db.system", "postgresql")
+		span.SetTag("db.table", table(db))
+		db.InstanceSet(querySpanKey, span)
+	}
+}
+
+func (p *TracingPlugin) after(string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(querySpanKey)
+		if !ok {
+			return
+		}
+
+		span := value.(*sentry.Span)
+		span.Description = db.Statement.SQL.String()
+		span.Status = sentry.SpanStatusOK
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			span.Status = sentry.SpanStatusInternalError
+		}
+		span.Finish()
+	}
+}
+
+// registerAround - registers callbacks around every gorm operation, statements
+// which are only built in dry run mode are skipped
+func registerAround(db *gorm.DB, name string, before, after func(operation string) func(*gorm.DB)) error {
+	before = skipDryRun(before)
+	after = skipDryRun(after)
+
+	cb := db.Callback()
+	errs := []error{
+		cb.Create().Before("gorm:create").Register(name+":before_create", before("create")),
+		cb.Create().After("gorm:create").Register(name+":after_create", after("create")),
+		cb.Query().Before("gorm:query").Register(name+":before_query", before("query")),
+		cb.Query().After("gorm:query").Register(name+":after_query", after("query")),
+		cb.Update().Before("gorm:update").Register(name+":before_update", before("update")),
+		cb.Update().After("gorm:update").Register(name+":after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register(name+":before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register(name+":after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register(name+":before_row", before("row")),
+		cb.Row().After("gorm:row").Register(name+":after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register(name+":before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register(name+":after_raw", after("raw")),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func skipDryRun(callback func(operation string) func(*gorm.DB)) func(operation string) func(*gorm.DB) {
+	return func(operation string) func(*gorm.DB) {
+		fn := callback(operation)
+		return func(db *gorm.DB) {
+			if !db.DryRun {
+				fn(db)
+			}
+		}
+	}
+}
+
+func table(db *gorm.DB) string {
+	if db.Statement.Table != "" {
+		return db.Statement.Table
+	}
+	return "unknown"
+}
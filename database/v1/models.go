@@ -1,16 +1,29 @@
 package database
 
+// ConnectionConfig - connection settings, DATABASE_URL overrides all other settings when set
 type ConnectionConfig struct {
-	PostgresPort     string `default:"5432" envconfig:"POSTGRES_PORT"`
-	PostgresHostname string `default:"localhost" envconfig:"POSTGRES_HOSTNAME"`
-	PostgresUser     string `default:"postgres" envconfig:"POSTGRES_USER"`
-	PostgresPassword string `default:"postgres" envconfig:"POSTGRES_PASSWORD"`
-	PostgresDBName   string `default:"postgres" envconfig:"POSTGRES_DB"`
-	PostgresSSLMode  string `default:"disable" envconfig:"POSTGRES_SSL_MODE"`
-	PostgresSchema   string `default:"public" envconfig:"POSTGRES_SCHEMA"`
+	PostgresPort             string   `default:"5432" envconfig:"POSTGRES_PORT"`
+	PostgresHostname         string   `default:"localhost" envconfig:"POSTGRES_HOSTNAME"`
+	PostgresUser             string   `default:"postgres" envconfig:"POSTGRES_USER"`
+	PostgresPassword         string   `default:"postgres" envconfig:"POSTGRES_PASSWORD"`
+	PostgresDBName           string   `default:"postgres" envconfig:"POSTGRES_DB"`
+	PostgresSSLMode          string   `default:"disable" envconfig:"POSTGRES_SSL_MODE"`
+	PostgresSSLRootCert      string   `envconfig:"POSTGRES_SSL_ROOT_CERT"`
+	PostgresSSLCert          string   `envconfig:"POSTGRES_SSL_CERT"`
+	PostgresSSLKey           string   `envconfig:"POSTGRES_SSL_KEY"`
+	PostgresSchema           string   `default:"public" envconfig:"POSTGRES_SCHEMA"`
+	PostgresApplicationName  string   `envconfig:"POSTGRES_APPLICATION_NAME"`
+	PostgresConnectTimeout   string   `envconfig:"POSTGRES_CONNECT_TIMEOUT"`
+	PostgresStatementTimeout string   `envconfig:"POSTGRES_STATEMENT_TIMEOUT"`
+	PostgresReplicaHosts     []string `envconfig:"POSTGRES_REPLICA_HOSTS"`
+	DatabaseURL              string   `envconfig:"DATABASE_URL"`
 }
 
 type Config struct {
-	MaxOpenConns string `default:"10" envconfig:"PG_MAX_OPEN_CONNS"`
-	MaxIdleConns string `default:"2" envconfig:"PG_MAX_IDLE_CONNS"`
+	MaxOpenConns       string `default:"10" envconfig:"PG_MAX_OPEN_CONNS"`
+	MaxIdleConns       string `default:"2" envconfig:"PG_MAX_IDLE_CONNS"`
+	ReplicaPolicy      string `default:"round-robin" envconfig:"PG_REPLICA_POLICY"`
+	LogLevel           string `default:"warn" envconfig:"PG_LOG_LEVEL"`
+	SlowQueryThreshold string `default:"200ms" envconfig:"PG_SLOW_QUERY_THRESHOLD"`
+	LogParameters      string `default:"false" envconfig:"PG_LOG_PARAMETERS"`
 }
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// OutboxMessage - event stored in the outbox table until it is published
+type OutboxMessage struct {
+	ID            uuid.UUID         `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Topic         string            `gorm:"not null" json:"topic"`
+	Key           string            `json:"key,omitempty"`
+	Payload       json.RawMessage   `gorm:"type:jsonb;not null" json:"payload"`
+	Headers       map[string]string `gorm:"type:jsonb;serializer:json" json:"headers,omitempty"`
+	Status        string            `gorm:"not null;default:pending;index:idx_outbox_messages_due,priority:1" json:"status"`
+	Attempts      int               `gorm:"not null;default:0" json:"attempts"`
+	LastError     string            `json:"lastError,omitempty"`
+	NextAttemptAt time.Time         `gorm:"not null;index:idx_outbox_messages_due,priority:2" json:"nextAttemptAt"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	SentAt        *time.Time        `json:"sentAt,omitempty"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
+// Publisher - delivers outbox messages, e.g. to a message broker
+type Publisher interface {
+	Publish(ctx context.Context, msg OutboxMessage) error
+}
+
+// MigrateOutbox - creates the outbox table
+func MigrateOutbox(db *gorm.DB) error {
+	return db.AutoMigrate(&OutboxMessage{})
+}
+
+// EnqueueOutbox - writes an event to the outbox using the transaction of the context,
+// so it is only published if the surrounding transaction commits
+func EnqueueOutbox(ctx context.Context, db *gorm.DB, topic, key string, payload interface{}, headers map[string]string) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return Conn(ctx, db).Create(&OutboxMessage{
+		Topic:         topic,
+		Key:           key,
+		Payload:       data,
+		Headers:       headers,
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// OutboxOption - configures an OutboxRelay
+type OutboxOption func(*OutboxRelay)
+
+// WithOutboxBatchSize - sets how many messages are claimed per poll
+func WithOutboxBatchSize(size int) OutboxOption {
+	return func(r *OutboxRelay) {
+		r.batchSize = size
+	}
+}
+
+// WithOutboxPollInterval - sets the pause between polls of an empty outbox
+func WithOutboxPollInterval(interval time.Duration) OutboxOption {
+	return func(r *OutboxRelay) {
+		r.pollInterval = interval
+	}
+}
+
+// WithOutboxRetries - sets the attempts before a message is dead-lettered and the backoff between them
+func WithOutboxRetries(maxAttempts int, minBackoff, maxBackoff time.Duration) OutboxOption {
+	return func(r *OutboxRelay) {
+		r.maxAttempts = maxAttempts
+		r.minBackoff = minBackoff
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// OutboxRelay - polls the outbox and hands due messages to the publisher.
+// Delivery is at-least-once, publishers must tolerate duplicates.
+type OutboxRelay struct {
+	db           *gorm.DB
+	publisher    Publisher
+	logger       *zap.Logger
+	batchSize    int
+	pollInterval time.Duration
+	maxAttempts  int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+}
+
+// NewOutboxRelay - creates a relay publishing the outbox messages
+func NewOutboxRelay(db *gorm.DB, publisher Publisher, logger *zap.Logger, opts ...OutboxOption) *OutboxRelay {
+	r := &OutboxRelay{
+		db:           db,
+		publisher:    publisher,
+		logger:       logger,
+		batchSize:    100,
+		pollInterval: time.Second,
+		maxAttempts:  10,
+		minBackoff:   time.Second,
+		maxBackoff:   10 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run - relays messages until the context is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	for {
+		n, err := r.ProcessBatch(ctx)
+		if err != nil {
+			r.logger.Error("[ERROR] relaying outbox messages", zap.Error(err))
+		}
+
+		if n < r.batchSize || err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(r.pollInterval):
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// ProcessBatch - claims and publishes one batch of due messages, returns the number of claimed messages
+func (r *OutboxRelay) ProcessBatch(ctx context.Context) (int, error) {
+	var messages []OutboxMessage
+	err := RunInTx(ctx, r.db, func(ctx context.Context, tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", OutboxPending, time.Now()).
+			Order("created_at").
+			Limit(r.batchSize).
+			Find(&messages).Error
+		if err != nil {
+			return err
+		}
+
+		for _, msg := range messages {
+			err = tx.Model(&OutboxMessage{}).Where("id = ?", msg.ID).Updates(r.publish(ctx, msg)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return len(messages), err
+}
+
+// publish - publishes the message and returns the resulting state changes
+func (r *OutboxRelay) publish(ctx context.Context, msg OutboxMessage) map[string]interface{} {
+	err := r.publisher.Publish(ctx, msg)
+	if err == nil {
+		return map[string]interface{}{
+			"status":   OutboxSent,
+			"attempts": msg.Attempts + 1,
+			"sent_at":  time.Now(),
+		}
+	}
+
+	attempts := msg.Attempts + 1
+	log := r.logger.With(zap.String("id", msg.ID.String()), zap.String("topic", msg.Topic), zap.Int("attempts", attempts), zap.Error(err))
+	if attempts >= r.maxAttempts {
+		log.Error("[ERROR] publishing outbox message, moving it to dead letter")
+		return map[string]interface{}{
+			"status":     OutboxDead,
+			"attempts":   attempts,
+			"last_error": err.Error(),
+		}
+	}
+
+	log.Warn("[RETRY] publishing outbox message")
+	return map[string]interface{}{
+		"attempts":        attempts,
+		"last_error":      err.Error(),
+		"next_attempt_at": time.Now().Add(backoff(attempts, r.minBackoff, r.maxBackoff)),
+	}
+}
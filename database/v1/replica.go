@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	RoundRobin       = "round-robin"
+	LeastConnections = "least-connections"
+)
+
+var primaryKey = contextKey{key: "primary"}
+
+// RoundRobinPolicy - routes reads to the replicas in turn
+type RoundRobinPolicy struct {
+	next uint64
+}
+
+func (p *RoundRobinPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	i := atomic.AddUint64(&p.next, 1)
+	return connPools[(i-1)%uint64(len(connPools))]
+}
+
+// LeastConnectionsPolicy - routes reads to the replica with the fewest connections in use
+type LeastConnectionsPolicy struct{}
+
+func (LeastConnectionsPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	selected := connPools[0]
+	least := -1
+	for _, connPool := range connPools {
+		sqlDB, ok := connPool.(*sql.DB)
+		if !ok {
+			continue
+		}
+		if inUse := sqlDB.Stats().InUse; least < 0 || inUse < least {
+			selected = connPool
+			least = inUse
+		}
+	}
+	return selected
+}
+
+// WithPrimary - marks the context so that Conn routes reads to the primary,
+// e.g. to read data right after writing it
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+// UsePrimary - routes all statements of db to the primary
+func UsePrimary(db *gorm.DB) *gorm.DB {
+	return db.Clauses(dbresolver.Write).Session(&gorm.Session{})
+}
+
+func usesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey).(bool)
+	return primary
+}
+
+func replicaPolicy(name string) (dbresolver.Policy, error) {
+	switch name {
+	case RoundRobin, "":
+		return &RoundRobinPolicy{}, nil
+	case LeastConnections:
+		return LeastConnectionsPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown replica policy %q", name)
+	}
+}
+
+// replicaResolver - routes reads to the replicas and writes and transactions to the primary
+func replicaResolver(db ConnectionConfig, c Config) (*dbresolver.DBResolver, error) {
+	policy, err := replicaPolicy(c.ReplicaPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]gorm.Dialector, 0, len(db.PostgresReplicaHosts))
+	for _, host := range db.PostgresReplicaHosts {
+		replica, err := db.withHost(host)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, postgres.Open(replica.DSN()))
+	}
+
+	return dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   policy,
+	}), nil
+}
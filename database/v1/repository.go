@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotFound - returned by the repository when no record matches
+var ErrNotFound = errors.New("record not found")
+
+// Page - typed counterpart of Pagination holding the loaded records
+type Page[T any] struct {
+	PerPage     int    `json:"perPage,omitempty"`
+	CurrentPage int    `json:"currentPage,omitempty"`
+	Sort        string `json:"sort,omitempty"`
+	Total       int64  `json:"total"`
+	TotalPages  int    `json:"totalPages"`
+	Data        []T    `json:"data"`
+}
+
+// Repository - generic CRUD repository for the model T
+type Repository[T any] struct {
+	db *gorm.DB
+}
+
+// NewRepository - creates a repository for the model T
+func NewRepository[T any](db *gorm.DB) *Repository[T] {
+	return &Repository[T]{db: db}
+}
+
+// Get - loads the record with the given primary key
+func (r *Repository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	var item T
+	err := r.conn(ctx).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).First(&item).Error
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return &item, nil
+}
+
+// List - loads a page of records
+func (r *Repository[T]) List(ctx context.Context, pagination *Pagination) (*Page[T], error) {
+	var items []T
+	db := r.conn(ctx)
+	err := db.Scopes(Paginate(new(T), pagination, db)).Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return newPage(pagination, items), nil
+}
+
+// ListWhere - loads a page of records matching the query
+func (r *Repository[T]) ListWhere(ctx context.Context, pagination *Pagination, query string, args ...interface{}) (*Page[T], error) {
+	var items []T
+	db := r.conn(ctx)
+	err := db.Scopes(PaginateQuery(new(T), pagination, db, query, args...)).Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return newPage(pagination, items), nil
+}
+
+// Create - inserts the record
+func (r *Repository[T]) Create(ctx context.Context, item *T) error {
+	return r.conn(ctx).Create(item).Error
+}
+
+// Update - updates all fields of the record, ErrNotFound if it does not exist
+func (r *Repository[T]) Update(ctx context.Context, item *T) error {
+	result := r.conn(ctx).Select("*").Updates(item)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete - deletes the record with the given primary key
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}) error {
+	result := r.conn(ctx).Where(clause.Eq{Column: clause.PrimaryColumn, Value: id}).Delete(new(T))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Upsert - inserts the record or updates all fields on primary key conflict
+func (r *Repository[T]) Upsert(ctx context.Context, item *T) error {
+	return r.conn(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(item).Error
+}
+
+// Exists - reports whether a record matches the query
+func (r *Repository[T]) Exists(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	var exists bool
+	db := r.conn(ctx)
+	err := db.Raw("SELECT EXISTS (?)", db.Model(new(T)).Select("1").Where(query, args...)).Scan(&exists).Error
+	return exists, err
+}
+
+func (r *Repository[T]) conn(ctx context.Context) *gorm.DB {
+	return Conn(ctx, r.db)
+}
+
+func newPage[T any](pagination *Pagination, items []T) *Page[T] {
+	return &Page[T]{
+		PerPage:     pagination.GetPerPage(),
+		CurrentPage: pagination.GetCurrentPage(),
+		Sort:        pagination.GetSort(),
+		Total:       pagination.Total,
+		TotalPages:  pagination.TotalPages,
+		Data:        items,
+	}
+}
+
+func mapError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,249 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	auth "github.com/tjarkmeyer/golang-toolkit/auth/v1"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	tenantField = "TenantID"
+	// maxIdentifierLength - longer identifiers are truncated by postgres
+	maxIdentifierLength = 63
+)
+
+var (
+	// ErrMissingTenant - returned when a tenant scoped model is used without a tenant in the context
+	ErrMissingTenant = errors.New("no tenant in context")
+	// ErrTenantMismatch - returned when a record is written with the tenant ID of another tenant
+	ErrTenantMismatch = errors.New("tenant ID does not match the tenant in context")
+	// ErrInvalidTenant - returned when a tenant ID cannot be used as part of a schema name
+	ErrInvalidTenant = errors.New("tenant ID must only contain a-z, 0-9 and _")
+
+	bypassTenantKey = contextKey{key: "bypassTenant"}
+	validSchema     = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// WithoutTenant - disables the tenant scope for the context, e.g. for admin jobs
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassTenantKey, true)
+}
+
+// TenantFromContext - returns the customer ID of the authenticated user
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := auth.GetCustomerID(ctx)
+	return tenant, ok && tenant != ""
+}
+
+// TenancyPlugin - scopes queries, updates and deletes of models with a TenantID field
+// to the tenant of the context and sets the field on inserts and updates. Upserts only
+// update conflicting rows of the same tenant. Writing the tenant ID of another tenant
+// fails with ErrTenantMismatch. CopyFrom bypasses the plugin.
+type TenancyPlugin struct{}
+
+// NewTenancyPlugin - creates the tenancy plugin
+func NewTenancyPlugin() *TenancyPlugin {
+	return &TenancyPlugin{}
+}
+
+func (p *TenancyPlugin) Name() string {
+	return "toolkit:tenancy"
+}
+
+func (p *TenancyPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	errs := []error{
+		cb.Create().Before("gorm:create").Register(p.Name()+":create", p.setTenant),
+		cb.Query().Before("gorm:query").Register(p.Name()+":query", p.scope),
+		cb.Update().Before("gorm:update").Register(p.Name()+":update", p.update),
+		cb.Delete().Before("gorm:delete").Register(p.Name()+":delete", p.scope),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *TenancyPlugin) setTenant(db *gorm.DB) {
+	tenant, field, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+
+	eachRecord(db, func(rv reflect.Value) {
+		value, zero := field.ValueOf(db.Statement.Context, rv)
+		if zero {
+			db.AddError(field.Set(db.Statement.Context, rv, tenant))
+		} else if !sameTenant(value, tenant) {
+			db.AddError(ErrTenantMismatch)
+		}
+	})
+
+	// upserts must not update the conflicting row of another tenant
+	if c, ok := db.Statement.Clauses[clause.OnConflict{}.Name()]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			onConflict.Where.Exprs = append(onConflict.Where.Exprs, tenantEq(field, tenant))
+			db.Statement.AddClause(onConflict)
+		}
+	}
+}
+
+// update - scopes the update to the tenant and rejects moving records to another tenant
+func (p *TenancyPlugin) update(db *gorm.DB) {
+	tenant, field, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+
+	switch dest := db.Statement.Dest.(type) {
+	case map[string]interface{}:
+		for _, key := range []string{field.Name, field.DBName} {
+			if value, ok := dest[key]; ok && !sameTenant(value, tenant) {
+				db.AddError(ErrTenantMismatch)
+				return
+			}
+		}
+	default:
+		rv := reflect.Indirect(reflect.ValueOf(dest))
+		if rv.Kind() == reflect.Struct && rv.Type() == db.Statement.Schema.ModelType {
+			value, zero := field.ValueOf(db.Statement.Context, rv)
+			switch {
+			case !zero && !sameTenant(value, tenant):
+				db.AddError(ErrTenantMismatch)
+				return
+			case zero && rv.CanAddr():
+				// records updated with all fields would otherwise leave their tenant
+				if err := field.Set(db.Statement.Context, rv, tenant); err != nil {
+					db.AddError(err)
+					return
+				}
+			case zero && selected(db, field):
+				db.AddError(ErrTenantMismatch)
+				return
+			}
+		}
+	}
+
+	p.scope(db)
+}
+
+func sameTenant(value interface{}, tenant string) bool {
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	return rv.IsValid() && fmt.Sprint(rv.Interface()) == tenant
+}
+
+func (p *TenancyPlugin) scope(db *gorm.DB) {
+	tenant, field, ok := tenantOf(db)
+	if !ok {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{tenantEq(field, tenant)}})
+}
+
+func tenantEq(field *schema.Field, tenant string) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant}
+}
+
+// selected - reports whether the field is written although it is zero
+func selected(db *gorm.DB, field *schema.Field) bool {
+	for _, s := range db.Statement.Selects {
+		if s == "*" || s == field.Name || s == field.DBName {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantOf - resolves the tenant of a statement on a tenant scoped model
+func tenantOf(db *gorm.DB) (string, *schema.Field, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return "", nil, false
+	}
+
+	field := db.Statement.Schema.LookUpField(tenantField)
+	if field == nil {
+		return "", nil, false
+	}
+
+	ctx := db.Statement.Context
+	if bypass, _ := ctx.Value(bypassTenantKey).(bool); bypass {
+		return "", nil, false
+	}
+
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		db.AddError(ErrMissingTenant)
+		return "", nil, false
+	}
+	return tenant, field, true
+}
+
+// TenantSchemas - schema-per-tenant mode, every tenant owns the schema `<prefix><tenant>`
+type TenantSchemas struct {
+	prefix   string
+	fallback string
+}
+
+// NewTenantSchemas - creates the schema-per-tenant mode, the schema of the
+// connection config stays on the search_path behind the tenant schema
+func NewTenantSchemas(db ConnectionConfig, prefix string) *TenantSchemas {
+	return &TenantSchemas{
+		prefix:   prefix,
+		fallback: db.PostgresSchema,
+	}
+}
+
+// Schema - returns the schema name of the tenant. Tenant IDs are not rewritten, as
+// different IDs could map to the same schema, so IDs with other characters than
+// a-z, 0-9 and _ or exceeding the maximum identifier length are rejected with ErrInvalidTenant.
+func (s *TenantSchemas) Schema(tenant string) (string, error) {
+	if !validSchema.MatchString(tenant) || len(s.prefix)+len(tenant) > maxIdentifierLength {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTenant, tenant)
+	}
+	return s.prefix + tenant, nil
+}
+
+// Create - creates the schema of the tenant if it does not exist
+func (s *TenantSchemas) Create(ctx context.Context, db *gorm.DB, tenant string) error {
+	name, err := s.Schema(tenant)
+	if err != nil {
+		return err
+	}
+	return Conn(ctx, db).Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", quoteIdentifier(name))).Error
+}
+
+// RunInTx - runs fn in a transaction whose search_path points to the schema of the context's tenant
+func (s *TenantSchemas) RunInTx(ctx context.Context, db *gorm.DB, fn func(ctx context.Context, tx *gorm.DB) error, opts ...TxOption) error {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ErrMissingTenant
+	}
+
+	name, err := s.Schema(tenant)
+	if err != nil {
+		return err
+	}
+
+	searchPath := quoteIdentifier(name)
+	if s.fallback != "" {
+		searchPath += ", " + quoteIdentifier(s.fallback)
+	}
+
+	return RunInTx(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+		err := tx.Exec("SET LOCAL search_path TO " + searchPath).Error
+		if err != nil {
+			return err
+		}
+		return fn(ctx, tx)
+	}, opts...)
+}
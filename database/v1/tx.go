@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+)
+
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+type contextKey struct {
+	key string
+}
+
+var txKey = contextKey{key: "tx"}
+
+// TxOption - configures a transaction started by RunInTx
+type TxOption func(*txConfig)
+
+type txConfig struct {
+	options     sql.TxOptions
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+// WithIsolation - sets the isolation level of the transaction
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(c *txConfig) {
+		c.options.Isolation = level
+	}
+}
+
+// ReadOnly - starts a read-only transaction
+func ReadOnly() TxOption {
+	return func(c *txConfig) {
+		c.options.ReadOnly = true
+	}
+}
+
+// WithRetries - sets how often a transaction is attempted and the backoff between attempts
+func WithRetries(maxAttempts int, minBackoff, maxBackoff time.Duration) TxOption {
+	return func(c *txConfig) {
+		c.maxAttempts = maxAttempts
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// RunInTx - runs fn inside a transaction which is also propagated through the context.
+// Serialization failures and deadlocks are retried with a bounded exponential backoff.
+// When the context already carries a transaction, fn runs in a nested savepoint instead.
+func RunInTx(ctx context.Context, db *gorm.DB, fn func(ctx context.Context, tx *gorm.DB) error, opts ...TxOption) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx.Transaction(func(nested *gorm.DB) error {
+			return fn(context.WithValue(ctx, txKey, nested), nested)
+		})
+	}
+
+	cfg := txConfig{
+		maxAttempts: 3,
+		minBackoff:  50 * time.Millisecond,
+		maxBackoff:  time.Second,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(context.WithValue(ctx, txKey, tx), tx)
+		}, &cfg.options)
+		if err == nil || attempt >= cfg.maxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cfg.backoff(attempt)):
+		}
+	}
+}
+
+// TxFromContext - returns the transaction started by RunInTx, if any
+func TxFromContext(ctx context.Context) (*gorm.DB, bool) {
+	tx, ok := ctx.Value(txKey).(*gorm.DB)
+	return tx, ok
+}
+
+// ContextWithTx - propagates a transaction through the context like RunInTx does
+func ContextWithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txKey, tx)
+}
+
+// Conn - returns the transaction of the context or db bound to the context
+func Conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	if usesPrimary(ctx) {
+		return UsePrimary(db.WithContext(ctx))
+	}
+	return db.WithContext(ctx)
+}
+
+// IsRetryable - reports whether err is a Postgres serialization failure or deadlock
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
+
+func (c txConfig) backoff(attempt int) time.Duration {
+	return backoff(attempt, c.minBackoff, c.maxBackoff)
+}
+
+// backoff - exponential backoff with jitter, bounded by maxDelay
+func backoff(attempt int, minDelay, maxDelay time.Duration) time.Duration {
+	d := minDelay << (attempt - 1)
+	if d <= 0 || d > maxDelay {
+		d = maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -6,17 +6,22 @@ require (
 	cloud.google.com/go/storage v1.30.1
 	github.com/Nerzal/gocloak/v11 v11.2.0
 	github.com/TheZeroSlave/zapsentry v1.15.0
+	github.com/andybalholm/brotli v1.0.5
 	github.com/gabriel-vasile/mimetype v1.4.1
 	github.com/getsentry/sentry-go v0.21.0
 	github.com/go-chi/chi/v5 v5.0.8
 	github.com/gofrs/uuid v4.4.0+incompatible
 	github.com/golangci/golangci-lint v1.50.1
-	github.com/hnlq715/gobreak v1.0.1
+	github.com/jackc/pgconn v1.13.0
+	github.com/jackc/pgx/v4 v4.17.2
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/klauspost/compress v1.16.5
+	github.com/robfig/cron/v3 v3.0.1
 	go.uber.org/zap v1.24.0
 	google.golang.org/api v0.114.0
 	gorm.io/driver/postgres v1.4.5
 	gorm.io/gorm v1.25.1
+	gorm.io/plugin/dbresolver v1.4.1
 )
 
 require (
@@ -32,13 +37,11 @@ require (
 	github.com/googleapis/enterprise-certificate-proxy v0.2.3 // indirect
 	github.com/googleapis/gax-go/v2 v2.7.1 // indirect
 	github.com/jackc/chunkreader/v2 v2.0.1 // indirect
-	github.com/jackc/pgconn v1.13.0 // indirect
 	github.com/jackc/pgio v1.0.0 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgproto3/v2 v2.3.1 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20200714003250-2b9c44734f2b // indirect
 	github.com/jackc/pgtype v1.12.0 // indirect
-	github.com/jackc/pgx/v4 v4.17.2 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/opentracing/opentracing-go v1.2.0 // indirect
 	github.com/prometheus/client_model v0.3.0 // indirect
@@ -62,12 +65,12 @@ require (
 	github.com/lib/pq v1.10.7 // indirect
 	github.com/matttproud/golang_protobuf_extensions v1.0.4 // indirect
 	github.com/pkg/errors v0.9.1
-	github.com/prometheus/client_golang v1.14.0 // indirect
-	github.com/sony/gobreaker v0.5.0 // indirect
+	github.com/prometheus/client_golang v1.14.0
+	github.com/sony/gobreaker v0.5.0
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.8.0 // indirect
 	golang.org/x/crypto v0.7.0 // indirect
-	golang.org/x/oauth2 v0.6.0 // indirect
+	golang.org/x/oauth2 v0.6.0
 	google.golang.org/genproto v0.0.0-20230320184635-7606e756e683 // indirect
 	google.golang.org/grpc v1.53.0 // indirect
 )
@@ -0,0 +1,126 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/tjarkmeyer/golang-toolkit/auth/v1/session"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Authenticator - adds credentials to outgoing requests
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Refresher - authenticator whose credentials are renewed when a request is answered
+// with 401, the request is then sent once more
+type Refresher interface {
+	Authenticator
+	Refresh(ctx context.Context) error
+}
+
+// AuthenticatorFunc - adapts a function to an Authenticator
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate - calls the function
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// WithAuth - authenticates every request of the client
+func WithAuth(auth Authenticator) ClientOption {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+// WithAuth - authenticates the request, overriding the authenticator of the client
+func (r *Request) WithAuth(auth Authenticator) *Request {
+	next := r.clone()
+	next.auth = auth
+	return next
+}
+
+// BearerToken - sends a static bearer token
+func BearerToken(token string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BasicAuth - sends the credentials as basic auth
+func BasicAuth(username, password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// GoCloakSession - sends the token of the Keycloak session
+func GoCloakSession(s session.GoCloakSession) Refresher {
+	return &goCloakAuth{session: s}
+}
+
+type goCloakAuth struct {
+	session session.GoCloakSession
+}
+
+func (a *goCloakAuth) Authenticate(req *http.Request) error {
+	return a.session.AddAuthTokenToRequest(req)
+}
+
+// Refresh - refreshes the token and logs in again if the refresh token is no longer valid
+func (a *goCloakAuth) Refresh(context.Context) error {
+	if err := a.session.ForceRefresh(); err != nil {
+		return a.session.ForceAuthenticate()
+	}
+	return nil
+}
+
+// ClientCredentials - sends a token of the OAuth2 client credentials flow,
+// the token is cached until it expires
+func ClientCredentials(tokenURL, clientID, clientSecret string, scopes ...string) Refresher {
+	return &clientCredentialsAuth{
+		config: &clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     tokenURL,
+			Scopes:       scopes,
+		},
+	}
+}
+
+type clientCredentialsAuth struct {
+	config *clientcredentials.Config
+	mu     sync.Mutex
+	token  *oauth2.Token
+}
+
+func (a *clientCredentialsAuth) Authenticate(req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.token.Valid() {
+		token, err := a.config.Token(req.Context())
+		if err != nil {
+			return err
+		}
+		a.token = token
+	}
+
+	a.token.SetAuthHeader(req)
+	return nil
+}
+
+// Refresh - drops the cached token so the next request fetches a new one
+func (a *clientCredentialsAuth) Refresh(context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.token = nil
+	return nil
+}
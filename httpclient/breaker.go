@@ -0,0 +1,172 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+)
+
+// ErrCircuitOpen - returned when the circuit breaker of the operation rejects the call
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+var (
+	breakersMu  sync.RWMutex
+	metricsOnce sync.Once
+	breakers    = make(map[string]*breaker)
+	configured  = make(map[string]BreakerSettings)
+
+	// the metrics keep the names and labels of github.com/hnlq715/gobreak used before
+	breakerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gobreak",
+		Name:      "requests",
+		Help:      "gobreak request count.",
+	}, []string{"name", "state"})
+
+	requestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gobreak",
+		Name:      "request_latency_histogram",
+		Help:      "gobreak request latency histogram.",
+	}, []string{"name"})
+)
+
+// registerBreakerMetrics - registers the metrics on first use instead of in init, so they
+// can share the collectors of hnlq715/gobreak when a service still imports it
+func registerBreakerMetrics() {
+	metricsOnce.Do(func() {
+		breakerRequests = registerCollector(prometheus.DefaultRegisterer, breakerRequests)
+		requestLatency = registerCollector(prometheus.DefaultRegisterer, requestLatency)
+	})
+}
+
+// registerCollector - registers the collector or returns the equal one already registered
+func registerCollector[C prometheus.Collector](registerer prometheus.Registerer, collector C) C {
+	err := registerer.Register(collector)
+	if err == nil {
+		return collector
+	}
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(C); ok {
+			return existing
+		}
+	}
+	panic(err)
+}
+
+// breakerEvent - state label of gobreak_requests for the outcome of a call
+func breakerEvent(err error, failure bool) string {
+	switch {
+	case err == nil && !failure:
+		return "success"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "context-deadline-exceeded"
+	case errors.Is(err, context.Canceled):
+		// spelled as by gobreak
+		return "context-cancled"
+	case errors.Is(err, gobreaker.ErrTooManyRequests):
+		return "too-many-requests"
+	case errors.Is(err, gobreaker.ErrOpenState):
+		return "circuit-open"
+	}
+	return "failure"
+}
+
+// BreakerSettings - circuit breaker configuration of an operation
+type BreakerSettings struct {
+	// MaxRequests - calls allowed through as probes while half-open
+	MaxRequests uint32
+	// Interval - period after which the counts are cleared while closed
+	Interval time.Duration
+	// Timeout - period of the open state before the breaker becomes half-open
+	Timeout time.Duration
+	// ReadyToTrip - decides by the counts whether a failure opens the breaker
+	ReadyToTrip func(counts gobreaker.Counts) bool
+	// IsFailure - decides whether a call counts as failure, defaults to FailOnServerError
+	IsFailure func(resp *http.Response, err error) bool
+}
+
+// DefaultBreakerSettings - three half-open probes, counts cleared every 5s,
+// open for 10s after at least 3 consecutive failures at a failure ratio of 60%
+func DefaultBreakerSettings() BreakerSettings {
+	return BreakerSettings{
+		MaxRequests: 3,
+		Interval:    5 * time.Second,
+		Timeout:     10 * time.Second,
+		ReadyToTrip: DefaultReadyToTrip,
+		IsFailure:   FailOnServerError,
+	}
+}
+
+// DefaultReadyToTrip - trips after at least 3 consecutive failures at a failure ratio of 60%
+func DefaultReadyToTrip(counts gobreaker.Counts) bool {
+	failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
+	return counts.ConsecutiveFailures >= 3 && failureRatio >= 0.6
+}
+
+// FailOnServerError - counts errors, missing responses, 429 and 5xx responses as failures
+func FailOnServerError(resp *http.Response, err error) bool {
+	if err != nil || resp == nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// ConfigureBreaker - sets the circuit breaker settings of the operation name,
+// the current breaker of the operation is replaced
+func ConfigureBreaker(name string, s BreakerSettings) {
+	defaults := DefaultBreakerSettings()
+	if s.ReadyToTrip == nil {
+		s.ReadyToTrip = defaults.ReadyToTrip
+	}
+	if s.IsFailure == nil {
+		s.IsFailure = defaults.IsFailure
+	}
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	configured[name] = s
+	delete(breakers, name)
+}
+
+type breaker struct {
+	cb        *gobreaker.TwoStepCircuitBreaker
+	isFailure func(resp *http.Response, err error) bool
+}
+
+// breakerFor - returns the breaker of the operation name, created on first use
+func breakerFor(name string) *breaker {
+	breakersMu.RLock()
+	b, ok := breakers[name]
+	breakersMu.RUnlock()
+	if ok {
+		return b
+	}
+
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	if b, ok := breakers[name]; ok {
+		return b
+	}
+
+	s, ok := configured[name]
+	if !ok {
+		s = DefaultBreakerSettings()
+	}
+	b = &breaker{
+		cb: gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+			Name:        name,
+			MaxRequests: s.MaxRequests,
+			Interval:    s.Interval,
+			Timeout:     s.Timeout,
+			ReadyToTrip: s.ReadyToTrip,
+		}),
+		isFailure: s.IsFailure,
+	}
+	breakers[name] = b
+	return b
+}
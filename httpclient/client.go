@@ -0,0 +1,130 @@
+package httpclient
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// settings - configuration of the client which requests can override
+type settings struct {
+	httpClient         HTTPClient
+	middlewares        []Middleware
+	logger             *zap.Logger
+	app                string
+	headers            map[string]string
+	auth               Authenticator
+	fallback           func(context.Context, error) error
+	retry              *RetryPolicy
+	timeout            time.Duration
+	maxResponseSize    int64
+	compression        string
+	compressionMinSize int
+}
+
+// Client - long-lived client holding the configuration shared by its requests.
+// It is immutable after creation and safe for concurrent use.
+type Client struct {
+	settings
+	baseURL string
+}
+
+// ClientOption - configures a Client
+type ClientOption func(*Client)
+
+// WithHTTPClient - sets the HTTP client executing the requests
+func WithHTTPClient(httpClient HTTPClient) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithMiddleware - wraps the HTTP client of every request with the middlewares,
+// they run for every attempt inside the circuit breaker
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares[:len(c.middlewares):len(c.middlewares)], middlewares...)
+	}
+}
+
+// WithDefaultHeaders - sets headers sent with every request
+func WithDefaultHeaders(headers map[string]string) ClientOption {
+	return func(c *Client) {
+		c.headers = headers
+	}
+}
+
+// WithDefaultRetry - sets the retry policy of every request
+func WithDefaultRetry(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		if policy.RetryOn == nil {
+			policy.RetryOn = RetryOnDefault
+		}
+		c.retry = &policy
+	}
+}
+
+// WithDefaultTimeout - sets the timeout of every call including retries
+func WithDefaultTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithDefaultFallback - sets the fallback of every request, see Request.WithFallback
+func WithDefaultFallback(fallback func(context.Context, error) error) ClientOption {
+	return func(c *Client) {
+		c.fallback = fallback
+	}
+}
+
+// WithDefaultMaxResponseSize - limits the size of every decoded response body
+func WithDefaultMaxResponseSize(size int64) ClientOption {
+	return func(c *Client) {
+		c.maxResponseSize = size
+	}
+}
+
+// WithDefaultRequestCompression - compresses every request body of at least minSize bytes
+func WithDefaultRequestCompression(encoding string, minSize int) ClientOption {
+	return func(c *Client) {
+		c.compression = encoding
+		c.compressionMinSize = minSize
+	}
+}
+
+// NewClient - creates a client for the base URL, by default with an HTTP client waiting 30s
+// for response headers, so streamed responses are not cut off. WithDefaultTimeout bounds whole calls.
+func NewClient(baseURL, app string, logger *zap.Logger, opts ...ClientOption) *Client {
+	c := &Client{
+		settings: settings{
+			httpClient: GetWithHeaderTimeout(30 * time.Second),
+			logger:     logger,
+			app:        app,
+		},
+		baseURL: baseURL,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Request - creates a request to the path below the base URL, the path may contain
+// parameters like {id}. The operation name selects the circuit breaker.
+func (c *Client) Request(ctx context.Context, method, operationName, path string) *Request {
+	url := c.baseURL
+	if path != "" {
+		url = strings.TrimSuffix(url, "/") + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	return &Request{
+		settings: c.settings,
+		ctx:      ctx,
+		method:   method,
+		name:     operationName,
+		url:      url,
+	}
+}
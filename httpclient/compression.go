@@ -0,0 +1,216 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding - encodings decoded by responseBodyReader
+const acceptEncoding = "gzip, deflate, br, zstd"
+
+// ErrResponseTooLarge - returned when the decoded response body exceeds the configured maximum size
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// WithMaxResponseSize - limits the size of the decoded response body, protects against zip bombs
+func (r *Request) WithMaxResponseSize(size int64) *Request {
+	next := r.clone()
+	next.maxResponseSize = size
+	return next
+}
+
+// WithRequestCompression - compresses request bodies of at least minSize bytes,
+// encoding is one of gzip, deflate, br or zstd
+func (r *Request) WithRequestCompression(encoding string, minSize int) *Request {
+	next := r.clone()
+	next.compression = encoding
+	next.compressionMinSize = minSize
+	return next
+}
+
+// requestBody - returns the body to send, its content type and content encoding,
+// the body is buffered when it has to be compressed or replayed by retries or after a refresh
+func (r *Request) requestBody() (io.Reader, string, string, error) {
+	if r.body == nil {
+		return nil, "", "", nil
+	}
+	_, refreshable := r.auth.(Refresher)
+	body, contentType, err := r.body()
+	if err != nil || body == nil || (r.retry == nil && r.compression == "" && !refreshable) {
+		return body, contentType, "", err
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if r.compression == "" || len(data) < r.compressionMinSize {
+		return bytes.NewReader(data), contentType, "", nil
+	}
+
+	compressed, err := compress(r.compression, data)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return bytes.NewReader(compressed), contentType, r.compression, nil
+}
+
+func compress(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		w, err = zstd.NewWriter(&buf)
+	default:
+		err = fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decoder - reader of a decoded body closing the decoders and the body
+type decoder struct {
+	io.Reader
+	closers []func() error
+}
+
+func (d *decoder) Close() error {
+	var err error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if closeErr := d.closers[i](); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// decode - wraps the body with the decoders of the encodings in reverse order of application
+func decode(body io.ReadCloser, contentEncoding string, maxSize int64) (io.ReadCloser, error) {
+	d := &decoder{Reader: body, closers: []func() error{body.Close}}
+
+	encodings := strings.Split(contentEncoding, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encoding := strings.ToLower(strings.TrimSpace(encodings[i])); encoding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			r := &gzipReader{r: d.Reader}
+			d.Reader = r
+			d.closers = append(d.closers, r.Close)
+		case "deflate":
+			r, err := deflateReader(d.Reader)
+			if err != nil {
+				_ = d.Close()
+				return nil, err
+			}
+			d.Reader = r
+			d.closers = append(d.closers, r.Close)
+		case "br":
+			d.Reader = brotli.NewReader(d.Reader)
+		case "zstd":
+			r, err := zstd.NewReader(d.Reader)
+			if err != nil {
+				_ = d.Close()
+				return nil, err
+			}
+			d.Reader = r
+			d.closers = append(d.closers, func() error {
+				r.Close()
+				return nil
+			})
+		default:
+			_ = d.Close()
+			return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+		}
+	}
+
+	if maxSize > 0 {
+		d.Reader = &limitedReader{r: d.Reader, remaining: maxSize}
+	}
+	return d, nil
+}
+
+// gzipReader - reads the gzip header on the first Read, so empty bodies are read as empty
+type gzipReader struct {
+	r  io.Reader
+	zr *gzip.Reader
+}
+
+func (g *gzipReader) Read(p []byte) (int, error) {
+	if g.zr == nil {
+		zr, err := gzip.NewReader(g.r)
+		if err != nil {
+			return 0, err
+		}
+		g.zr = zr
+	}
+	return g.zr.Read(p)
+}
+
+func (g *gzipReader) Close() error {
+	if g.zr == nil {
+		return nil
+	}
+	return g.zr.Close()
+}
+
+// deflateReader - decodes zlib wrapped as well as raw deflate streams,
+// as servers use both for the deflate encoding
+func deflateReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// limitedReader - fails with ErrResponseTooLarge instead of truncating like io.LimitReader
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	// one byte more than allowed to detect bodies exceeding the limit
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrResponseTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,106 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDecode(t *testing.T) {
+	const content = "hello, compressed world"
+
+	encoded := func(encoding string) []byte {
+		data, err := compress(encoding, []byte(content))
+		if err != nil {
+			t.Fatalf("compressing %s: %v", encoding, err)
+		}
+		return data
+	}
+
+	var rawDeflate bytes.Buffer
+	fw, _ := flate.NewWriter(&rawDeflate, flate.DefaultCompression)
+	_, _ = fw.Write([]byte(content))
+	_ = fw.Close()
+
+	gzipThenBrotli, err := compress("br", encoded("gzip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		maxSize  int64
+		want     string
+		wantErr  error
+	}{
+		{name: "identity", encoding: "", body: []byte(content), want: content},
+		{name: "gzip", encoding: "gzip", body: encoded("gzip"), want: content},
+		{name: "x-gzip", encoding: "x-gzip", body: encoded("gzip"), want: content},
+		{name: "empty gzip body", encoding: "gzip", body: nil, want: ""},
+		{name: "zlib deflate", encoding: "deflate", body: encoded("deflate"), want: content},
+		{name: "raw deflate", encoding: "deflate", body: rawDeflate.Bytes(), want: content},
+		{name: "brotli", encoding: "br", body: encoded("br"), want: content},
+		{name: "zstd", encoding: "zstd", body: encoded("zstd"), want: content},
+		{name: "multiple encodings", encoding: "gzip, br", body: gzipThenBrotli, want: content},
+		{name: "within max size", encoding: "gzip", body: encoded("gzip"), maxSize: int64(len(content)), want: content},
+		{name: "exceeds max size", encoding: "gzip", body: encoded("gzip"), maxSize: 5, wantErr: ErrResponseTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := decode(io.NopCloser(bytes.NewReader(tt.body)), tt.encoding, tt.maxSize)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			defer reader.Close()
+
+			got, err := io.ReadAll(reader)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reading: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeUnsupportedEncoding(t *testing.T) {
+	if _, err := decode(io.NopCloser(bytes.NewReader(nil)), "compress", 0); err == nil {
+		t.Fatal("expected an error for an unsupported encoding")
+	}
+}
+
+func TestCallWithoutBodyIgnoresContentEncoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		client := NewClient(srv.URL, "test", zap.NewNop())
+		response, body, err := client.Request(context.Background(), method, "decode-no-body", "").Call()
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if response.StatusCode != http.StatusNoContent || body != "" {
+			t.Errorf("%s: got status %d and body %q", method, response.StatusCode, body)
+		}
+	}
+}
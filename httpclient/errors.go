@@ -0,0 +1,63 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ErrTimeout - returned when the timeout of the call or of the HTTP client is exceeded,
+// while the deadline of the caller's context surfaces as context.DeadlineExceeded
+var ErrTimeout = errors.New("http call timed out")
+
+// maxErrorBody - maximum length of the body kept in an HTTPError
+const maxErrorBody = 4 << 10
+
+// HTTPError - response with a non-2xx status code
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body - the beginning of the response body
+	Body string
+}
+
+func newHTTPError(resp *http.Response, content string) *HTTPError {
+	if len(content) > maxErrorBody {
+		content = content[:maxErrorBody]
+	}
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       content,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("http status %s", e.Status)
+	}
+	return fmt.Sprintf("http status %s: %s", e.Status, e.Body)
+}
+
+// callError - distinguishes the cancellation or deadline of the caller's context
+// from timeouts of the call, circuit breaker rejections are returned as they are
+func (r *Request) callError(ctx context.Context, err error) error {
+	if errors.Is(err, ErrCircuitOpen) {
+		return err
+	}
+	if r.ctx != nil && r.ctx.Err() != nil {
+		return fmt.Errorf("calling %s: %w", r.name, r.ctx.Err())
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s after %s", ErrTimeout, r.name, r.timeout)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: %s: %v", ErrTimeout, r.name, err)
+	}
+	return err
+}
@@ -2,38 +2,23 @@ package httpclient
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"time"
 
-	"github.com/hnlq715/gobreak"
 	"go.uber.org/zap"
 )
 
-type Client struct {
-	ctx              context.Context
-	name             string
-	baseURL          string
-	params           map[string]string
-	additionalParams map[string][]string
-	headerParams     map[string]string
-	method           string
-	app              string
-	HTTPClient       HTTPClient
-	body             io.Reader
-	logger           *zap.Logger
-	fallback         func(context.Context, error) error
-}
-
-func New(ctx context.Context, timeout time.Duration, method, operationName, baseURL, app string, logger *zap.Logger) *Client {
-	return &Client{
-		ctx:        ctx,
-		method:     method,
-		name:       operationName,
-		baseURL:    baseURL,
-		app:        app,
-		HTTPClient: Get(timeout),
-		logger:     logger,
+// New - creates a call with its own client whose With methods modify it in place.
+//
+// Deprecated: use NewClient and Client.Request to share connections and configuration.
+func New(ctx context.Context, timeout time.Duration, method, operationName, baseURL, app string, logger *zap.Logger) *LegacyClient {
+	httpClient := Get(timeout)
+	return &LegacyClient{
+		HTTPClient: httpClient,
+		request:    NewClient(baseURL, app, logger, WithHTTPClient(httpClient)).Request(ctx, method, operationName, ""),
 	}
 }
 
@@ -47,139 +32,324 @@ func Get(timeout time.Duration) HTTPClient {
 	}
 }
 
-func (c *Client) WithHTTPMethod(method string) *Client {
-	c.method = method
-	return c
+// GetWithHeaderTimeout - creates an HTTP client which only limits the wait for the response
+// headers, reading the body is bounded by the context of the call, e.g. for streams
+func GetWithHeaderTimeout(timeout time.Duration) HTTPClient {
+	return &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:          60,
+			MaxIdleConnsPerHost:   60,
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+}
+
+func (r *Request) WithHTTPMethod(method string) *Request {
+	next := r.clone()
+	next.method = method
+	return next
 }
 
-func (c *Client) WithHTTClient(httpClient HTTPClient) *Client {
-	c.HTTPClient = httpClient
-	return c
+func (r *Request) WithHTTClient(httpClient HTTPClient) *Request {
+	next := r.clone()
+	next.httpClient = httpClient
+	return next
 }
 
-func (c *Client) WithParams(params map[string]string) *Client {
-	c.params = params
-	return c
+func (r *Request) WithParams(params map[string]string) *Request {
+	next := r.clone()
+	next.params = params
+	return next
 }
 
 // WithAdditionalParams - adds more query parameters of the same kind
-func (c *Client) WithAdditionalParams(params map[string][]string) *Client {
-	c.additionalParams = params
-	return c
+func (r *Request) WithAdditionalParams(params map[string][]string) *Request {
+	next := r.clone()
+	next.additionalParams = params
+	return next
 }
 
-func (ccient *Client) WithBody(body io.Reader) *Client {
-	ccient.body = body
-	return ccient
+func (r *Request) WithBody(body io.Reader) *Request {
+	next := r.clone()
+	next.body = func() (io.Reader, string, error) {
+		return body, "", nil
+	}
+	return next
 }
 
-func (c *Client) WithHeaderParams(headerParams map[string]string) *Client {
-	c.headerParams = headerParams
-	return c
+func (r *Request) WithHeaderParams(headerParams map[string]string) *Request {
+	next := r.clone()
+	next.headerParams = headerParams
+	return next
 }
 
-func (c *Client) WithFallback(fallback func(context.Context, error) error) *Client {
-	c.fallback = fallback
-	return c
+// WithTimeout - bounds the whole call including retries and reading the body,
+// the timeout of the HTTP client still applies to every attempt
+func (r *Request) WithTimeout(timeout time.Duration) *Request {
+	next := r.clone()
+	next.timeout = timeout
+	return next
 }
 
-func (c *Client) Call() (*http.Response, string, error) {
-	c.logger.With(zap.String("http_method", c.method), zap.String("base_url", c.baseURL))
-	c.logger.Info("[START] setting up client call")
+// WithFallback - sets the fallback called once with the final error of the call,
+// after all retries or when the circuit breaker rejects the call
+func (r *Request) WithFallback(fallback func(context.Context, error) error) *Request {
+	next := r.clone()
+	next.fallback = fallback
+	return next
+}
 
-	req, err := http.NewRequest(c.method, c.baseURL, c.body)
-	req.Close = true
+// Call - executes the request and reads the response body,
+// responses with a non-2xx status code are returned together with an *HTTPError
+func (r *Request) Call() (*http.Response, string, error) {
+	ctx, cancel := r.context()
+	defer cancel()
+
+	response, err := r.execute(ctx)
 	if err != nil {
-		c.logger.Error("[ERROR] while creating the request")
 		return nil, "", err
 	}
 
-	query := req.URL.Query()
-	for key, value := range c.params {
-		query.Add(key, value)
-	}
+	var content string
 
-	if c.additionalParams != nil {
-		for key, additonalValueIn := range c.additionalParams {
-			for _, value := range additonalValueIn {
-				query.Add(key, value)
-			}
+	if response != nil {
+		reader, err := responseBodyReader(response, r.maxResponseSize)
+		if err != nil {
+			r.logger.Error("[ERROR] reading response body", zap.Error(err))
+			return nil, "", err
+		}
+		defer closeResponseBodyReader(reader, r.logger)
+
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			err = r.callError(ctx, err)
+			r.logger.Error("[ERROR] reading response body", zap.Error(err))
+			return nil, "", err
+		} else {
+			content = string(body)
 		}
 	}
 
-	req.URL.RawQuery = query.Encode()
+	if response != nil && (response.StatusCode < 200 || response.StatusCode > 299) {
+		return response, content, newHTTPError(response, content)
+	}
+
+	return response, content, nil
+}
+
+// context - returns the context of the call bounded by the timeout of the call if any
+func (r *Request) context() (context.Context, context.CancelFunc) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// execute - builds the request and sends it, the response body is left unread
+func (r *Request) execute(ctx context.Context) (*http.Response, error) {
+	r.logger.With(zap.String("http_method", r.method), zap.String("url", r.url))
+	r.logger.Info("[START] setting up client call")
+
+	requestURL, err := r.requestURL()
+	if err != nil {
+		r.logger.Error("[ERROR] while creating the request")
+		return nil, err
+	}
+
+	body, contentType, encoding, err := r.requestBody()
+	if err != nil {
+		r.logger.Error("[ERROR] reading request body", zap.Error(err))
+		return nil, err
+	}
 
-	for key, value := range c.headerParams {
+	req, err := http.NewRequestWithContext(ctx, r.method, requestURL.String(), body)
+	if err != nil {
+		if closer, ok := body.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		r.logger.Error("[ERROR] while creating the request")
+		return nil, err
+	}
+	req.Close = true
+
+	for key, value := range r.headers {
+		req.Header.Set(key, value)
+	}
+	for key, value := range r.headerParams {
 		req.Header.Add(key, value)
 	}
+	if contentType != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
 
-	c.logger.With(
+	r.logger.With(
 		zap.String("URL", req.URL.String()),
-		zap.Any("headers", c.headerParams),
-		zap.Any("params", c.params),
-		zap.Any("body", c.body),
+		zap.Any("headers", r.headerParams),
+		zap.Any("params", r.params),
 	)
 
-	response, err := c.call(req)
+	response, err := r.send(ctx, req)
 
 	if err != nil {
-		c.logger.Error("[ERROR] executing request", zap.Error(err))
-		return nil, "", err
+		// the fallback sees the final error once all attempts are exhausted
+		err = r.handleError(ctx, r.callError(ctx, err))
+		if err != nil {
+			r.logger.Error("[ERROR] executing request", zap.Error(err))
+		}
+		return nil, err
 	}
 
-	var content string
+	return response, nil
+}
 
-	if response != nil {
-		reader, err := responseBodyReader(response)
-		defer closeResponseBodyReader(reader, c.logger)
+// send - calls until the response is final according to the retry policy
+func (r *Request) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	registerBreakerMetrics()
 
-		if err != nil {
-			c.logger.Error("[ERROR] reading response body", zap.Error(err))
-			return nil, "", err
+	retryable := r.retry.retryable(req)
+	refreshed := false
+
+	for attempt := 1; ; attempt++ {
+		response, err := r.call(req)
+		if response == nil && err == nil {
+			// nothing to refresh or retry without a response
+			return nil, nil
 		}
 
-		body, err := io.ReadAll(reader)
+		if refresher, ok := r.auth.(Refresher); ok && !refreshed && err == nil && response != nil && response.StatusCode == http.StatusUnauthorized {
+			refreshed = true
+			if refreshErr := refresher.Refresh(ctx); refreshErr != nil {
+				r.logger.Error("[ERROR] refreshing credentials", zap.Error(refreshErr))
+				return response, nil
+			}
+			r.logger.Info("[RETRY] calling " + r.name + " with refreshed credentials")
+			discard(response)
+
+			next, err := replay(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			req = next
+			attempt--
+			continue
+		}
+
+		if !retryable || attempt >= r.retry.MaxAttempts || !r.retry.RetryOn(response, err) {
+			return response, err
+		}
+
+		delay, ok := r.retry.wait(attempt, response)
+		if !ok {
+			return response, err
+		}
+		status := 0
+		if response != nil {
+			status = response.StatusCode
+		}
+		discard(response)
+		r.logger.Warn("[RETRY] calling "+r.name,
+			zap.Int("attempt", attempt),
+			zap.Int("status", status),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		next, err := replay(ctx, req)
 		if err != nil {
-			c.logger.Error("[ERROR] reading response body", zap.Error(err))
-			return nil, "", err
-		} else {
-			content = string(body)
+			return nil, err
 		}
+		req = next
 	}
-
-	return response, content, nil
 }
 
-func (c *Client) call(req *http.Request) (*http.Response, error) {
-	response := make(chan *http.Response, 1)
+// replay - returns a copy of the request with a fresh body
+func replay(ctx context.Context, req *http.Request) (*http.Request, error) {
+	next := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
 
-	errs := gobreak.Do(c.ctx, c.name, func(context.Context) error {
-		resp, err := c.HTTPClient.Do(req)
-		if resp != nil {
-			response <- resp
+// call - executes one attempt guarded by the circuit breaker of the operation
+func (r *Request) call(req *http.Request) (*http.Response, error) {
+	if r.auth != nil {
+		if err := r.auth.Authenticate(req); err != nil {
+			return nil, fmt.Errorf("authenticating request: %w", err)
 		}
+	}
 
-		return err
-	}, c.fallback)
+	b := breakerFor(r.name)
 
-	if errs == nil {
-		return <-response, nil
+	done, err := b.cb.Allow()
+	if err != nil {
+		breakerRequests.WithLabelValues(r.name, breakerEvent(err, true)).Inc()
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, r.name)
 	}
 
-	return nil, errs
+	start := time.Now()
+	resp, err := Chain(r.httpClient, r.middlewares...).Do(req)
+	failure := b.isFailure(resp, err)
+	done(!failure)
+	breakerRequests.WithLabelValues(r.name, breakerEvent(err, failure)).Inc()
+	requestLatency.WithLabelValues(r.name).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("http client returned neither response nor error")
+	}
+	return resp, nil
 }
 
-// responseBodyReader - resolves different content types of response bodies
-func responseBodyReader(res *http.Response) (io.ReadCloser, error) {
-	var reader io.ReadCloser
-	var err error
+// handleError - passes the error to the fallback if any
+func (r *Request) handleError(ctx context.Context, err error) error {
+	if r.fallback == nil {
+		return err
+	}
 
-	switch res.Header.Get("Content-Encoding") {
-	default:
-		reader = res.Body
+	err = r.fallback(ctx, err)
+	if err != nil {
+		breakerRequests.WithLabelValues(r.name, "fallback-failure").Inc()
+	} else {
+		breakerRequests.WithLabelValues(r.name, "fallback-success").Inc()
 	}
+	return err
+}
 
-	return reader, err
+// responseBodyReader - resolves different content encodings of response bodies,
+// responses without body are not decoded even if they name a content encoding
+func responseBodyReader(res *http.Response, maxSize int64) (io.ReadCloser, error) {
+	if res.Body == nil {
+		return decode(http.NoBody, "", maxSize)
+	}
+	if res.Body == http.NoBody || res.ContentLength == 0 ||
+		res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified ||
+		(res.Request != nil && res.Request.Method == http.MethodHead) {
+		return decode(res.Body, "", maxSize)
+	}
+	return decode(res.Body, res.Header.Get("Content-Encoding"), maxSize)
 }
 
 func closeResponseBodyReader(reader io.ReadCloser, log *zap.Logger) {
@@ -5,3 +5,25 @@ import "net/http"
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
+
+// Doer - executes HTTP requests, e.g. an HTTPClient wrapped by middleware
+type Doer = HTTPClient
+
+// DoerFunc - adapts a function to a Doer
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do - calls the function
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware - wraps a Doer with additional behavior
+type Middleware func(next Doer) Doer
+
+// Chain - wraps the Doer with the middlewares, the first middleware is the outermost
+func Chain(doer Doer, middlewares ...Middleware) Doer {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		doer = middlewares[i](doer)
+	}
+	return doer
+}
@@ -0,0 +1,57 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+const contentTypeJSON = "application/json"
+
+// CallJSON - calls and decodes a 2xx response into T, other responses are returned as *HTTPError
+func CallJSON[T any](r *Request) (T, error) {
+	var result T
+
+	_, content, err := r.withDefaultHeader("Accept", contentTypeJSON).Call()
+	if err != nil {
+		return result, err
+	}
+
+	if strings.TrimSpace(content) == "" {
+		return result, nil
+	}
+	err = json.Unmarshal([]byte(content), &result)
+	return result, err
+}
+
+// DoJSON - sends the request encoded as JSON body and decodes the response like CallJSON
+func DoJSON[Req, Resp any](r *Request, request Req) (Resp, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		var result Resp
+		return result, err
+	}
+
+	next := r.clone()
+	next.body = func() (io.Reader, string, error) {
+		return bytes.NewReader(body), contentTypeJSON, nil
+	}
+	return CallJSON[Resp](next)
+}
+
+// withDefaultHeader - returns a copy of the request setting the header unless it is already configured
+func (r *Request) withDefaultHeader(key, value string) *Request {
+	headers := make(map[string]string, len(r.headerParams)+1)
+	for k, v := range r.headerParams {
+		if strings.EqualFold(k, key) {
+			return r
+		}
+		headers[k] = v
+	}
+	headers[key] = value
+
+	next := r.clone()
+	next.headerParams = headers
+	return next
+}
@@ -0,0 +1,62 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// LegacyClient - call returned by New, its With methods modify it in place and return it.
+//
+// Deprecated: use NewClient and Client.Request, whose requests are immutable and can be shared.
+type LegacyClient struct {
+	HTTPClient HTTPClient
+	request    *Request
+}
+
+func (c *LegacyClient) WithHTTPMethod(method string) *LegacyClient {
+	c.request = c.request.WithHTTPMethod(method)
+	return c
+}
+
+func (c *LegacyClient) WithHTTClient(httpClient HTTPClient) *LegacyClient {
+	c.HTTPClient = httpClient
+	return c
+}
+
+func (c *LegacyClient) WithParams(params map[string]string) *LegacyClient {
+	c.request = c.request.WithParams(params)
+	return c
+}
+
+// WithAdditionalParams - adds more query parameters of the same kind
+func (c *LegacyClient) WithAdditionalParams(params map[string][]string) *LegacyClient {
+	c.request = c.request.WithAdditionalParams(params)
+	return c
+}
+
+func (c *LegacyClient) WithBody(body io.Reader) *LegacyClient {
+	c.request = c.request.WithBody(body)
+	return c
+}
+
+func (c *LegacyClient) WithHeaderParams(headerParams map[string]string) *LegacyClient {
+	c.request = c.request.WithHeaderParams(headerParams)
+	return c
+}
+
+func (c *LegacyClient) WithFallback(fallback func(context.Context, error) error) *LegacyClient {
+	c.request = c.request.WithFallback(fallback)
+	return c
+}
+
+// Request - returns the configured call as immutable Request, e.g. to use retries or streaming
+func (c *LegacyClient) Request() *Request {
+	return c.request.WithHTTClient(c.HTTPClient)
+}
+
+// Call - executes the call and reads the response body,
+// responses with a non-2xx status code are returned together with an *HTTPError
+func (c *LegacyClient) Call() (*http.Response, string, error) {
+	return c.Request().Call()
+}
@@ -0,0 +1,188 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Logging - logs method, URL, status and duration of every request
+func Logging(logger *zap.Logger) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+
+			fields := []zap.Field{
+				zap.String("http_method", req.Method),
+				zap.String("URL", req.URL.Redacted()),
+				zap.Duration("duration", time.Since(start)),
+			}
+			if err != nil || resp == nil {
+				logger.Error("[ERROR] http request", append(fields, zap.Error(err))...)
+				return resp, err
+			}
+			logger.Info("[DONE] http request", append(fields, zap.Int("status", resp.StatusCode))...)
+			return resp, nil
+		})
+	}
+}
+
+// Metrics - records the duration of every request by method, host and status code
+// in the histogram httpclient_roundtrip_duration_seconds of the registerer
+func Metrics(registerer prometheus.Registerer) Middleware {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "httpclient",
+		Name:      "roundtrip_duration_seconds",
+		Help:      "Duration of HTTP requests by method, host and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "host", "code"})
+
+	if err := registerer.Register(duration); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			panic(err)
+		}
+		duration = registered.ExistingCollector.(*prometheus.HistogramVec)
+	}
+
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+
+			code := "error"
+			if err == nil && resp != nil {
+				code = strconv.Itoa(resp.StatusCode)
+			}
+			duration.WithLabelValues(req.Method, req.URL.Host, code).Observe(time.Since(start).Seconds())
+			return resp, err
+		})
+	}
+}
+
+// Retry - retries requests according to the policy. Unlike with WithRetry the attempts
+// run inside the circuit breaker and count as one call. Requests with a body are only
+// retried if it can be replayed via GetBody.
+func Retry(policy RetryPolicy) Middleware {
+	if policy.RetryOn == nil {
+		policy.RetryOn = RetryOnDefault
+	}
+
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			retryable := policy.retryable(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil)
+
+			for attempt := 1; ; attempt++ {
+				resp, err := next.Do(req)
+				if !retryable || attempt >= policy.MaxAttempts || !policy.RetryOn(resp, err) {
+					return resp, err
+				}
+
+				delay, ok := policy.wait(attempt, resp)
+				if !ok {
+					return resp, err
+				}
+				discard(resp)
+
+				select {
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				case <-time.After(delay):
+				}
+
+				if req, err = replay(req.Context(), req); err != nil {
+					return nil, err
+				}
+			}
+		})
+	}
+}
+
+// Auth - authenticates every request, refreshes the credentials of a Refresher
+// once when the response is 401 and sends the request again
+func Auth(auth Authenticator) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := auth.Authenticate(req); err != nil {
+				return nil, fmt.Errorf("authenticating request: %w", err)
+			}
+			resp, err := next.Do(req)
+
+			refresher, ok := auth.(Refresher)
+			replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+			if !ok || !replayable || err != nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+
+			if err = refresher.Refresh(req.Context()); err != nil {
+				return resp, nil
+			}
+			discard(resp)
+
+			if req, err = replay(req.Context(), req); err != nil {
+				return nil, err
+			}
+			if err = auth.Authenticate(req); err != nil {
+				return nil, fmt.Errorf("authenticating request: %w", err)
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// Headers - sets the headers unless the request already has them
+func Headers(headers map[string]string) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			for key, value := range headers {
+				setDefault(req.Header, key, value)
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// Dump - logs requests and responses including headers at debug level, with their
+// bodies if body is true. Response bodies of event streams, of unknown length or larger
+// than 64KB are not dumped, as they would have to be read completely before returning.
+// Meant for debugging as credentials are logged as well.
+func Dump(logger *zap.Logger, body bool) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if !logger.Core().Enabled(zap.DebugLevel) {
+				return next.Do(req)
+			}
+
+			if dump, err := httputil.DumpRequestOut(req, body); err == nil {
+				logger.Debug("[DUMP] http request", zap.ByteString("request", dump))
+			}
+
+			resp, err := next.Do(req)
+			if err != nil || resp == nil {
+				return resp, err
+			}
+
+			if dump, err := httputil.DumpResponse(resp, body && dumpable(resp)); err == nil {
+				logger.Debug("[DUMP] http response", zap.ByteString("response", dump))
+			}
+			return resp, nil
+		})
+	}
+}
+
+// maxDumpSize - largest response body logged by Dump
+const maxDumpSize = 64 << 10
+
+// dumpable - reports whether the response body is small enough to be read by Dump
+func dumpable(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType != "text/event-stream" && resp.ContentLength >= 0 && resp.ContentLength <= maxDumpSize
+}
@@ -0,0 +1,85 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/go-chi/chi/v5/middleware"
+	auth "github.com/tjarkmeyer/golang-toolkit/auth/v1"
+)
+
+// Propagate - forwards the identity of the user, the trace and the request ID of the
+// request context to downstream services: x-userinfo and Authorization as set by
+// auth.UserInfoMiddleware, sentry-trace, baggage and traceparent of a child span of the
+// current transaction and the request ID of the chi RequestID middleware.
+// Headers already set on the request are kept.
+func Propagate(next HTTPClient) HTTPClient {
+	return &propagator{next: next}
+}
+
+type propagator struct {
+	next HTTPClient
+}
+
+func (p *propagator) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	if userinfo, ok := ctx.Value(auth.AuthHeader).(string); ok {
+		setDefault(req.Header, "x-userinfo", userinfo)
+	}
+	if authorization, ok := ctx.Value(auth.AuthToken).(string); ok {
+		setDefault(req.Header, "Authorization", authorization)
+	}
+	if requestID := middleware.GetReqID(ctx); requestID != "" {
+		setDefault(req.Header, middleware.RequestIDHeader, requestID)
+	}
+
+	if sentry.TransactionFromContext(ctx) == nil {
+		return p.next.Do(req)
+	}
+
+	span := sentry.StartSpan(ctx, "http.client")
+	span.Description = req.Method + " " + req.URL.String()
+	defer span.Finish()
+
+	req = req.WithContext(span.Context())
+	setDefault(req.Header, sentry.SentryTraceHeader, span.ToSentryTrace())
+	if baggage := span.ToBaggage(); baggage != "" {
+		setDefault(req.Header, sentry.SentryBaggageHeader, baggage)
+	}
+	setDefault(req.Header, "traceparent", traceparent(span))
+
+	resp, err := p.next.Do(req)
+	span.Status = spanStatus(resp, err)
+	return resp, err
+}
+
+// traceparent - W3C trace context of the span
+func traceparent(span *sentry.Span) string {
+	flags := "00"
+	if span.Sampled == sentry.SampledTrue {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", span.TraceID.Hex(), span.SpanID.Hex(), flags)
+}
+
+func spanStatus(resp *http.Response, err error) sentry.SpanStatus {
+	switch {
+	case err != nil:
+		return sentry.SpanStatusInternalError
+	case resp.StatusCode == http.StatusNotFound:
+		return sentry.SpanStatusNotFound
+	case resp.StatusCode >= 500:
+		return sentry.SpanStatusInternalError
+	case resp.StatusCode >= 400:
+		return sentry.SpanStatusInvalidArgument
+	}
+	return sentry.SpanStatusOK
+}
+
+func setDefault(header http.Header, key, value string) {
+	if header.Get(key) == "" {
+		header.Set(key, value)
+	}
+}
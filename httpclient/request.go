@@ -0,0 +1,201 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const contentTypeForm = "application/x-www-form-urlencoded"
+
+// Request - immutable description of a call, every With method returns a modified copy
+// so a request can be prepared once and shared between goroutines. Bodies given as
+// io.Reader can only be sent once, form, multipart and JSON bodies are recreated per call.
+type Request struct {
+	settings
+	ctx              context.Context
+	name             string
+	method           string
+	url              string
+	pathParams       map[string]string
+	params           map[string]string
+	additionalParams map[string][]string
+	query            url.Values
+	headerParams     map[string]string
+	body             func() (io.Reader, string, error)
+}
+
+// FormFile - file part of a multipart body
+type FormFile struct {
+	Field       string
+	FileName    string
+	ContentType string
+	Content     io.Reader
+}
+
+func (r *Request) clone() *Request {
+	next := *r
+	return &next
+}
+
+// WithContext - sets the context of the call
+func (r *Request) WithContext(ctx context.Context) *Request {
+	next := r.clone()
+	next.ctx = ctx
+	return next
+}
+
+// WithMiddleware - adds middlewares running inside the ones of the client
+func (r *Request) WithMiddleware(middlewares ...Middleware) *Request {
+	next := r.clone()
+	next.middlewares = append(r.middlewares[:len(r.middlewares):len(r.middlewares)], middlewares...)
+	return next
+}
+
+// WithPathParam - replaces the {key} placeholder of the path with the escaped value
+func (r *Request) WithPathParam(key, value string) *Request {
+	next := r.clone()
+	next.pathParams = make(map[string]string, len(r.pathParams)+1)
+	for k, v := range r.pathParams {
+		next.pathParams[k] = v
+	}
+	next.pathParams[key] = value
+	return next
+}
+
+// WithQuery - adds query values, time.Time values are formatted as RFC 3339,
+// slices add one value per element and everything else is formatted by fmt
+func (r *Request) WithQuery(key string, values ...interface{}) *Request {
+	next := r.clone()
+	next.query = make(url.Values, len(r.query)+1)
+	for k, v := range r.query {
+		next.query[k] = append([]string{}, v...)
+	}
+	for _, value := range values {
+		next.query[key] = append(next.query[key], queryValues(value)...)
+	}
+	return next
+}
+
+// WithForm - sends the values as URL encoded form body
+func (r *Request) WithForm(values url.Values) *Request {
+	encoded := values.Encode()
+
+	next := r.clone()
+	next.body = func() (io.Reader, string, error) {
+		return strings.NewReader(encoded), contentTypeForm, nil
+	}
+	return next
+}
+
+// WithMultipart - sends the fields and files as multipart/form-data body,
+// the contents of the files are streamed and can only be sent once
+func (r *Request) WithMultipart(fields map[string]string, files ...FormFile) *Request {
+	next := r.clone()
+	next.body = func() (io.Reader, string, error) {
+		pr, pw := io.Pipe()
+		w := multipart.NewWriter(pw)
+
+		go func() {
+			pw.CloseWithError(writeMultipart(w, fields, files))
+		}()
+
+		return pr, w.FormDataContentType(), nil
+	}
+	return next
+}
+
+func writeMultipart(w *multipart.Writer, fields map[string]string, files []FormFile) error {
+	for key, value := range fields {
+		if err := w.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+
+	for _, file := range files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(file.Field), quoteEscaper.Replace(file.FileName)))
+		header.Set("Content-Type", contentType)
+
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(part, file.Content); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// requestURL - resolves the path parameters and adds the query parameters
+func (r *Request) requestURL() (*url.URL, error) {
+	raw := r.url
+	for key, value := range r.pathParams {
+		raw = strings.ReplaceAll(raw, "{"+key+"}", url.PathEscape(value))
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	for key, value := range r.params {
+		query.Add(key, value)
+	}
+
+	if r.additionalParams != nil {
+		for key, additonalValueIn := range r.additionalParams {
+			for _, value := range additonalValueIn {
+				query.Add(key, value)
+			}
+		}
+	}
+
+	for key, values := range r.query {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+	return u, nil
+}
+
+func queryValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []byte:
+		return []string{string(v)}
+	case time.Time:
+		return []string{v.Format(time.RFC3339)}
+	case fmt.Stringer:
+		return []string{v.String()}
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		values := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, queryValues(rv.Index(i).Interface())...)
+		}
+		return values
+	}
+	return []string{fmt.Sprint(value)}
+}
@@ -0,0 +1,142 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy - configures how often and when a call is retried
+type RetryPolicy struct {
+	// MaxAttempts - attempts in total including the first one
+	MaxAttempts int
+	// MinBackoff, MaxBackoff - bounds of the exponential backoff with jitter,
+	// responses with a longer Retry-After are returned instead of retried
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// RetryOn - decides whether an attempt is retried, defaults to RetryOnDefault
+	RetryOn func(resp *http.Response, err error) bool
+	// RetryNonIdempotent - also retries POST and PATCH requests without an Idempotency-Key header
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy - three attempts with a backoff between 100ms and 5s
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  100 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+	}
+}
+
+// RetryOnDefault - retries network errors and 429, 502, 503 and 504 responses
+func RetryOnDefault(resp *http.Response, err error) bool {
+	if err != nil {
+		return RetryOnError(err)
+	}
+	return RetryOnStatus(http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout)(resp, nil)
+}
+
+// RetryOnStatus - retries responses with one of the status codes
+func RetryOnStatus(codes ...int) func(*http.Response, error) bool {
+	return func(resp *http.Response, err error) bool {
+		if err != nil || resp == nil {
+			return false
+		}
+		for _, code := range codes {
+			if resp.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RetryOnError - reports whether the error is a transient network error. Timeouts of
+// single attempts are retried, calls whose context is done stop before the next attempt.
+func RetryOnError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// WithRetry - retries the call according to the policy
+func (r *Request) WithRetry(policy RetryPolicy) *Request {
+	if policy.RetryOn == nil {
+		policy.RetryOn = RetryOnDefault
+	}
+	next := r.clone()
+	next.retry = &policy
+	return next
+}
+
+// retryable - reports whether the request may be sent more than once
+func (p *RetryPolicy) retryable(req *http.Request) bool {
+	if p == nil || p.MaxAttempts <= 1 {
+		return false
+	}
+	if p.RetryNonIdempotent || req.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// wait - returns the delay before the next attempt, a Retry-After header takes precedence.
+// It reports false if the Retry-After header asks to wait longer than MaxBackoff.
+func (p *RetryPolicy) wait(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if delay, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return delay, delay <= p.MaxBackoff
+		}
+	}
+
+	d := p.MinBackoff << (attempt - 1)
+	if d <= 0 || d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// retryAfter - parses a Retry-After header given in seconds or as HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// discard - drains and closes the body of a response which is retried
+func discard(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,168 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func testRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  10 * time.Millisecond,
+	}
+}
+
+func TestRetryAfterTransientTimeout(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	var fallbacks int32
+	client := NewClient(srv.URL, "test", zap.NewNop(),
+		WithHTTPClient(Get(50*time.Millisecond)),
+		WithDefaultRetry(testRetryPolicy()),
+		WithDefaultFallback(func(context.Context, error) error {
+			atomic.AddInt32(&fallbacks, 1)
+			return nil
+		}),
+	)
+
+	_, body, err := client.Request(context.Background(), http.MethodGet, "retry-timeout", "").Call()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body != "ok" {
+		t.Errorf("got body %q, want %q", body, "ok")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("got %d attempts, want 2", got)
+	}
+	if got := atomic.LoadInt32(&fallbacks); got != 0 {
+		t.Errorf("fallback called %d times, want 0", got)
+	}
+}
+
+func TestRetryStopsWhenRetryAfterExceedsMaxBackoff(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	response, _, err := New(context.Background(), time.Second, http.MethodGet, "retry-after", srv.URL, "test", zap.NewNop()).Request().
+		WithRetry(testRetryPolicy()).
+		Call()
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got response %v and error %v, want a 503 HTTPError", response, err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call took %s", elapsed)
+	}
+}
+
+func TestRetryHonoursShortRetryAfter(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	_, body, err := New(context.Background(), time.Second, http.MethodGet, "retry-after-short", srv.URL, "test", zap.NewNop()).Request().
+		WithRetry(testRetryPolicy()).
+		Call()
+	if err != nil || body != "ok" {
+		t.Fatalf("got body %q and error %v", body, err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("got %d attempts, want 2", got)
+	}
+}
+
+func TestFallbackCalledOnceAfterRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	fallbackErr := errors.New("fallback")
+	var fallbacks int32
+	var received error
+	_, _, err := New(context.Background(), time.Second, http.MethodGet, "retry-fallback", url, "test", zap.NewNop()).Request().
+		WithRetry(testRetryPolicy()).
+		WithFallback(func(_ context.Context, err error) error {
+			atomic.AddInt32(&fallbacks, 1)
+			received = err
+			return fallbackErr
+		}).
+		Call()
+
+	if !errors.Is(err, fallbackErr) {
+		t.Errorf("got error %v, want the error of the fallback", err)
+	}
+	if got := atomic.LoadInt32(&fallbacks); got != 1 {
+		t.Errorf("fallback called %d times, want 1", got)
+	}
+	if received == nil {
+		t.Error("fallback did not receive the error of the call")
+	}
+}
+
+func TestFallbackSwallowsFinalError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	response, body, err := New(context.Background(), time.Second, http.MethodGet, "retry-fallback-nil", url, "test", zap.NewNop()).Request().
+		WithRetry(testRetryPolicy()).
+		WithAuth(ClientCredentials(url+"/token", "id", "secret")).
+		WithFallback(func(context.Context, error) error { return nil }).
+		Call()
+	if response != nil || body != "" || err != nil {
+		t.Errorf("got response %v, body %q and error %v, want nothing", response, body, err)
+	}
+}
+
+func TestRetryStopsWhenCallTimesOut(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	_, _, err := New(context.Background(), time.Second, http.MethodGet, "retry-call-timeout", srv.URL, "test", zap.NewNop()).Request().
+		WithRetry(testRetryPolicy()).
+		WithTimeout(50 * time.Millisecond).
+		Call()
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v, want ErrTimeout", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
@@ -0,0 +1,191 @@
+package httpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxLineSize - maximum length of a line read by EventReader and NDJSONReader
+const maxLineSize = 1 << 20
+
+// Stream - executes the request and returns the decoded response body, which the caller
+// has to close. Responses with a non-2xx status code are returned as *HTTPError with the
+// body already closed. Reading the body is bounded by the context and timeout of the call,
+// HTTP clients with http.Client.Timeout as created by Get also cut off longer streams.
+func (r *Request) Stream() (*http.Response, io.ReadCloser, error) {
+	ctx, cancel := r.context()
+
+	response, err := r.execute(ctx)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if response == nil {
+		cancel()
+		return nil, http.NoBody, nil
+	}
+
+	reader, err := responseBodyReader(response, r.maxResponseSize)
+	if err != nil {
+		cancel()
+		r.logger.Error("[ERROR] reading response body", zap.Error(err))
+		return nil, nil, err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer cancel()
+		defer closeResponseBodyReader(reader, r.logger)
+		content, _ := io.ReadAll(io.LimitReader(reader, maxErrorBody))
+		return response, nil, newHTTPError(response, string(content))
+	}
+
+	return response, &streamReader{ReadCloser: reader, cancel: cancel}, nil
+}
+
+// streamReader - releases the context of the call when the body is closed
+type streamReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *streamReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// Download - writes the response body to w and reports the progress after every chunk,
+// total is -1 when the size of the decoded body is unknown
+func (r *Request) Download(w io.Writer, progress func(written, total int64)) (int64, error) {
+	response, reader, err := r.Stream()
+	if err != nil {
+		return 0, err
+	}
+	defer closeResponseBodyReader(reader, r.logger)
+
+	total := int64(-1)
+	if response != nil && response.Header.Get("Content-Encoding") == "" {
+		total = response.ContentLength
+	}
+
+	var written int64
+	buf := make([]byte, 32<<10)
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			if _, err = w.Write(buf[:n]); err != nil {
+				return written, err
+			}
+			written += int64(n)
+			if progress != nil {
+				progress(written, total)
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
+
+// Event - server-sent event
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// EventReader - reads server-sent events from a text/event-stream body
+type EventReader struct {
+	scanner *bufio.Scanner
+}
+
+// NewEventReader - creates an event reader, e.g. for the body returned by Stream
+func NewEventReader(r io.Reader) *EventReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	return &EventReader{scanner: scanner}
+}
+
+// Next - returns the next event, io.EOF when the stream has ended
+func (r *EventReader) Next() (Event, error) {
+	var event Event
+	var data []string
+
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line == "" {
+			// events without data are not dispatched
+			if len(data) > 0 {
+				event.Data = strings.Join(data, "\n")
+				return event, nil
+			}
+			event = Event{}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+	return Event{}, io.EOF
+}
+
+// NDJSONReader - reads newline delimited JSON values into T
+type NDJSONReader[T any] struct {
+	scanner *bufio.Scanner
+}
+
+// NewNDJSONReader - creates a newline delimited JSON reader, e.g. for the body returned by Stream
+func NewNDJSONReader[T any](r io.Reader) *NDJSONReader[T] {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	return &NDJSONReader[T]{scanner: scanner}
+}
+
+// Next - returns the next value, io.EOF when the stream has ended
+func (r *NDJSONReader[T]) Next() (T, error) {
+	var value T
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		err := json.Unmarshal(line, &value)
+		return value, err
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return value, err
+	}
+	return value, io.EOF
+}